@@ -1,18 +1,37 @@
 package main
 
 import (
+	"flag"
 	"log"
+	"os"
 
 	"github.com/hsibAD/api-gateway/internal/config"
 	"github.com/hsibAD/api-gateway/internal/server"
 )
 
 func main() {
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "YAML or TOML config file")
+	printConfig := flag.Bool("print-config", false, "print the effective configuration and exit")
+	flag.Parse()
+
 	// Load configuration
-	cfg := config.Load()
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	effective, err := cfg.Redacted().YAML()
+	if err != nil {
+		log.Fatalf("Failed to render configuration: %v", err)
+	}
+	if *printConfig {
+		os.Stdout.Write(effective)
+		return
+	}
+	log.Printf("Effective configuration:\n%s", effective)
 
 	// Create and start server
-	srv, err := server.NewServer(cfg)
+	srv, err := server.NewServer(cfg, *configFile)
 	if err != nil {
 		log.Fatalf("Failed to create server: %v", err)
 	}
@@ -20,4 +39,4 @@ func main() {
 	if err := srv.Run(); err != nil {
 		log.Fatalf("Failed to run server: %v", err)
 	}
-} 
\ No newline at end of file
+}
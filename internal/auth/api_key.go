@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	ErrInvalidAPIKey  = errors.New("invalid API key")
+	ErrAPIKeyNotFound = errors.New("API key not found")
+)
+
+const (
+	apiKeyPrefix          = "agw_"
+	apiKeyRecordPrefix    = "api_key:"
+	apiKeyLastUsedPrefix  = "api_key_last_used:"
+	apiKeyIndexKey        = "api_keys"
+	apiKeyLastUsedRefresh = time.Minute
+)
+
+// APIKey identifies a machine client. Only a hash of the secret is stored;
+// the raw key is returned once, when the key is created.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	OwnerID    string     `json:"owner_id"`
+	Role       string     `json:"role"`
+	Scopes     []string   `json:"scopes"`
+	SecretHash string     `json:"secret_hash,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+func (k *APIKey) Expired() bool {
+	return k.ExpiresAt != nil && time.Now().After(*k.ExpiresAt)
+}
+
+type APIKeyStore struct {
+	redis *redis.Client
+
+	// lastUsed remembers when this instance last wrote each key's
+	// last-used timestamp, so busy clients do not cost a write per request.
+	lastUsed sync.Map
+}
+
+func NewAPIKeyStore(client *redis.Client) *APIKeyStore {
+	return &APIKeyStore{
+		redis: client,
+	}
+}
+
+// Create stores a new key and returns it together with the raw key, which
+// has the form agw_<id>.<secret>.
+func (s *APIKeyStore) Create(ctx context.Context, key *APIKey) (string, error) {
+	id, err := randomToken(12)
+	if err != nil {
+		return "", err
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	key.ID = id
+	key.SecretHash = hashToken(secret)
+	key.CreatedAt = time.Now().UTC()
+
+	data, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+
+	pipe := s.redis.TxPipeline()
+	pipe.Set(ctx, apiKeyRecordPrefix+id, data, 0)
+	if key.ExpiresAt != nil {
+		pipe.ExpireAt(ctx, apiKeyRecordPrefix+id, *key.ExpiresAt)
+	}
+	pipe.SAdd(ctx, apiKeyIndexKey, id)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+
+	key.SecretHash = ""
+	return apiKeyPrefix + id + "." + secret, nil
+}
+
+// Authenticate resolves a raw key presented by a client.
+func (s *APIKeyStore) Authenticate(ctx context.Context, rawKey string) (*APIKey, error) {
+	id, secret, ok := strings.Cut(strings.TrimPrefix(rawKey, apiKeyPrefix), ".")
+	if !ok || !strings.HasPrefix(rawKey, apiKeyPrefix) || id == "" || secret == "" {
+		return nil, ErrInvalidAPIKey
+	}
+
+	key, err := s.get(ctx, id)
+	if err != nil {
+		if errors.Is(err, ErrAPIKeyNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(key.SecretHash), []byte(hashToken(secret))) != 1 {
+		return nil, ErrInvalidAPIKey
+	}
+	if key.Expired() {
+		return nil, ErrInvalidAPIKey
+	}
+
+	s.touch(ctx, key.ID)
+	key.SecretHash = ""
+	return key, nil
+}
+
+// List returns all keys, or only those of one owner when ownerID is set.
+func (s *APIKeyStore) List(ctx context.Context, ownerID string) ([]*APIKey, error) {
+	ids, err := s.redis.SMembers(ctx, apiKeyIndexKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]*APIKey, 0, len(ids))
+	for _, id := range ids {
+		key, err := s.get(ctx, id)
+		if err != nil {
+			if errors.Is(err, ErrAPIKeyNotFound) {
+				// The record expired; drop the dangling index entry.
+				s.redis.SRem(ctx, apiKeyIndexKey, id)
+				s.redis.Del(ctx, apiKeyLastUsedPrefix+id)
+				continue
+			}
+			return nil, err
+		}
+		if ownerID != "" && key.OwnerID != ownerID {
+			continue
+		}
+
+		lastUsed, err := s.redis.Get(ctx, apiKeyLastUsedPrefix+id).Time()
+		if err == nil {
+			key.LastUsedAt = &lastUsed
+		}
+		key.SecretHash = ""
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+func (s *APIKeyStore) Revoke(ctx context.Context, id string) error {
+	deleted, err := s.redis.Del(ctx, apiKeyRecordPrefix+id, apiKeyLastUsedPrefix+id).Result()
+	if err != nil {
+		return err
+	}
+	s.redis.SRem(ctx, apiKeyIndexKey, id)
+	s.lastUsed.Delete(id)
+
+	if deleted == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func (s *APIKeyStore) get(ctx context.Context, id string) (*APIKey, error) {
+	data, err := s.redis.Get(ctx, apiKeyRecordPrefix+id).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, err
+	}
+
+	var key APIKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// touch records the last-used time at most once per apiKeyLastUsedRefresh.
+// Failures are ignored: the timestamp is informational.
+func (s *APIKeyStore) touch(ctx context.Context, id string) {
+	now := time.Now()
+	if last, ok := s.lastUsed.Load(id); ok && now.Sub(last.(time.Time)) < apiKeyLastUsedRefresh {
+		return
+	}
+	s.lastUsed.Store(id, now)
+	s.redis.Set(ctx, apiKeyLastUsedPrefix+id, now.UTC(), 0)
+}
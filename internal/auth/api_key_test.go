@@ -0,0 +1,251 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/hsibAD/api-gateway/internal/config"
+)
+
+func createTestAPIKey(t *testing.T, s *APIKeyStore, ownerID string, scopes ...string) (*APIKey, string) {
+	t.Helper()
+	key := &APIKey{Name: "ci", OwnerID: ownerID, Role: "user", Scopes: scopes}
+	rawKey, err := s.Create(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return key, rawKey
+}
+
+func TestAPIKeyCreate(t *testing.T) {
+	client := newTestRedis(t)
+	s := NewAPIKeyStore(client)
+	key, rawKey := createTestAPIKey(t, s, "u1", "orders:read")
+
+	id, secret, ok := strings.Cut(strings.TrimPrefix(rawKey, apiKeyPrefix), ".")
+	if !strings.HasPrefix(rawKey, apiKeyPrefix) || !ok || id != key.ID || secret == "" {
+		t.Fatalf("raw key %q, want %s%s.<secret>", rawKey, apiKeyPrefix, key.ID)
+	}
+	if key.SecretHash != "" || key.CreatedAt.IsZero() {
+		t.Errorf("created key = %+v, want a creation time and no hash", key)
+	}
+
+	// Only the hash of the secret is stored.
+	data, err := client.Get(context.Background(), apiKeyRecordPrefix+key.ID).Bytes()
+	if err != nil {
+		t.Fatalf("read record: %v", err)
+	}
+	if strings.Contains(string(data), secret) {
+		t.Errorf("record %s holds the raw secret", data)
+	}
+	var stored APIKey
+	if err := json.Unmarshal(data, &stored); err != nil {
+		t.Fatalf("decode record: %v", err)
+	}
+	if stored.SecretHash != hashToken(secret) {
+		t.Errorf("stored hash %q, want the SHA-256 of the secret", stored.SecretHash)
+	}
+
+	_, other := createTestAPIKey(t, s, "u1")
+	if other == rawKey {
+		t.Errorf("two keys share the raw key %q", rawKey)
+	}
+}
+
+func TestAPIKeyAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	s := NewAPIKeyStore(newTestRedis(t))
+	created, rawKey := createTestAPIKey(t, s, "u1", "orders:read")
+
+	key, err := s.Authenticate(ctx, rawKey)
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if key.ID != created.ID || key.OwnerID != "u1" || key.Role != "user" || !reflect.DeepEqual(key.Scopes, []string{"orders:read"}) {
+		t.Errorf("Authenticate = %+v, want key %s of u1 with role user and scope orders:read", key, created.ID)
+	}
+	if key.SecretHash != "" {
+		t.Errorf("Authenticate returned the secret hash")
+	}
+}
+
+func TestAPIKeyAuthenticateRejects(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis(t)
+	s := NewAPIKeyStore(client)
+	_, rawKey := createTestAPIKey(t, s, "u1")
+	id, _, _ := strings.Cut(strings.TrimPrefix(rawKey, apiKeyPrefix), ".")
+
+	_, revokedKey := createTestAPIKey(t, s, "u1")
+	revokedID, _, _ := strings.Cut(strings.TrimPrefix(revokedKey, apiKeyPrefix), ".")
+	if err := s.Revoke(ctx, revokedID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+
+	// An expiry that has passed but whose record Redis has not dropped yet.
+	expired, expiredKey := createTestAPIKey(t, s, "u1")
+	past := time.Now().Add(-time.Minute)
+	expired.ExpiresAt = &past
+	expired.SecretHash = hashToken(strings.SplitN(expiredKey, ".", 2)[1])
+	data, _ := json.Marshal(expired)
+	if err := client.Set(ctx, apiKeyRecordPrefix+expired.ID, data, 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		rawKey string
+	}{
+		{"wrong secret", apiKeyPrefix + id + ".wrong"},
+		{"revoked", revokedKey},
+		{"expired", expiredKey},
+		{"unknown id", apiKeyPrefix + "unknown." + "secret"},
+		{"without prefix", strings.TrimPrefix(rawKey, apiKeyPrefix)},
+		{"without secret", apiKeyPrefix + id + "."},
+		{"without separator", apiKeyPrefix + id},
+		{"without id", apiKeyPrefix + ".secret"},
+		{"empty", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := s.Authenticate(ctx, tt.rawKey); !errors.Is(err, ErrInvalidAPIKey) {
+				t.Errorf("Authenticate error = %v, want ErrInvalidAPIKey", err)
+			}
+		})
+	}
+}
+
+func TestAPIKeyAuthenticateRedisDown(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	s := NewAPIKeyStore(client)
+	_, rawKey := createTestAPIKey(t, s, "u1")
+
+	// An outage is not a bad key.
+	server.SetError("ERR unavailable")
+	if _, err := s.Authenticate(context.Background(), rawKey); err == nil || errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Authenticate error = %v, want the Redis error", err)
+	}
+}
+
+func TestAPIKeyListAndRevoke(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	s := NewAPIKeyStore(client)
+
+	first, firstKey := createTestAPIKey(t, s, "u1")
+	second, _ := createTestAPIKey(t, s, "u2")
+	expiresAt := time.Now().Add(time.Hour)
+	expiring := &APIKey{Name: "temporary", OwnerID: "u1", Role: "user", ExpiresAt: &expiresAt}
+	if _, err := s.Create(ctx, expiring); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := s.Authenticate(ctx, firstKey); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+
+	ids := func(ownerID string) []string {
+		t.Helper()
+		keys, err := s.List(ctx, ownerID)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		var ids []string
+		for _, key := range keys {
+			if key.SecretHash != "" {
+				t.Errorf("List returned the secret hash of %s", key.ID)
+			}
+			if (key.LastUsedAt != nil) != (key.ID == first.ID) {
+				t.Errorf("key %s last used at %v, want set only for the key in use", key.ID, key.LastUsedAt)
+			}
+			ids = append(ids, key.ID)
+		}
+		return ids
+	}
+	if got, want := ids(""), []string{first.ID, second.ID, expiring.ID}; !reflect.DeepEqual(got, want) {
+		t.Errorf("List() = %v, want %v in creation order", got, want)
+	}
+	if got, want := ids("u1"), []string{first.ID, expiring.ID}; !reflect.DeepEqual(got, want) {
+		t.Errorf("List(u1) = %v, want %v", got, want)
+	}
+
+	// Redis drops the expired record; List drops its index entry.
+	server.FastForward(2 * time.Hour)
+	if got, want := ids("u1"), []string{first.ID}; !reflect.DeepEqual(got, want) {
+		t.Errorf("List(u1) after expiry = %v, want %v", got, want)
+	}
+	if isMember, _ := client.SIsMember(ctx, apiKeyIndexKey, expiring.ID).Result(); isMember {
+		t.Errorf("expired key %s left in the index", expiring.ID)
+	}
+
+	if err := s.Revoke(ctx, first.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if got, want := ids(""), []string{second.ID}; !reflect.DeepEqual(got, want) {
+		t.Errorf("List() after revoke = %v, want %v", got, want)
+	}
+	if _, err := s.Authenticate(ctx, firstKey); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Authenticate after revoke error = %v, want ErrInvalidAPIKey", err)
+	}
+	if err := s.Revoke(ctx, first.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("second Revoke error = %v, want ErrAPIKeyNotFound", err)
+	}
+}
+
+func TestMiddlewareAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	s := NewAPIKeyStore(client)
+	key, rawKey := createTestAPIKey(t, s, "u1", "orders:read")
+
+	j := newTestJWTAuth(t, config.SigningKeyConfig{ID: "test", Algorithm: "HS256"})
+	j.apiKeys = s
+	router := gin.New()
+	router.GET("/me", j.Middleware(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"user_id":    c.GetString("user_id"),
+			"role":       c.GetString("role"),
+			"scopes":     c.GetStringSlice("scopes"),
+			"api_key_id": c.GetString("api_key_id"),
+		})
+	})
+	serve := func(rawKey string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, "/me", nil)
+		request.Header.Set("X-API-Key", rawKey)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+		return w
+	}
+
+	w := serve(rawKey)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", w.Code, w.Body)
+	}
+	want := `{"api_key_id":"` + key.ID + `","role":"user","scopes":["orders:read"],"user_id":"u1"}`
+	if w.Body.String() != want {
+		t.Errorf("identity %s, want %s", w.Body, want)
+	}
+
+	if w := serve(strings.SplitN(rawKey, ".", 2)[0] + ".wrong"); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong secret status %d, want 401", w.Code)
+	}
+	server.SetError("ERR unavailable")
+	if w := serve(rawKey); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status with Redis down %d, want 503", w.Code)
+	}
+}
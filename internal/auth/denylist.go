@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/hsibAD/api-gateway/internal/config"
+)
+
+const (
+	revokedTokenKeyPrefix = "revoked_token:"
+	// revokedUserKeyPrefix maps a user ID to the time (RFC 3339 with
+	// nanoseconds) before which all of that user's access and refresh tokens
+	// are rejected. Cutoffs written as Unix seconds are still understood.
+	revokedUserKeyPrefix = "revoked_user:"
+)
+
+// Denylist tracks revoked access tokens in Redis. Lookups are cached locally:
+// revocations are cached until the token expires, while "still valid" answers
+// are only trusted for DenylistCacheTTL, which bounds how long another
+// gateway instance may keep accepting a token revoked elsewhere.
+type Denylist struct {
+	redis  *redis.Client
+	config *config.AuthConfig
+	cache  *lruCache
+}
+
+func NewDenylist(client *redis.Client, config *config.AuthConfig) *Denylist {
+	return &Denylist{
+		redis:  client,
+		config: config,
+		cache:  newLRUCache(config.DenylistCacheSize),
+	}
+}
+
+// RevokeToken denies a single access token until it would have expired anyway.
+func (d *Denylist) RevokeToken(ctx context.Context, claims *Claims) error {
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return ErrInvalidToken
+	}
+
+	ttl := time.Until(claims.ExpiresAt.Time)
+	if ttl <= 0 {
+		return nil
+	}
+
+	if err := d.redis.Set(ctx, revokedTokenKeyPrefix+claims.ID, 1, ttl).Err(); err != nil {
+		return err
+	}
+	d.cache.Set(claims.ID, true, ttl)
+	return nil
+}
+
+// RevokeUser rejects every token issued to the user up to now. The cutoff is
+// kept without expiry because refresh token families can outlive any fixed TTL.
+func (d *Denylist) RevokeUser(ctx context.Context, userID string) error {
+	if err := d.redis.Set(ctx, revokedUserKeyPrefix+userID, time.Now().Format(time.RFC3339Nano), 0).Err(); err != nil {
+		return err
+	}
+	// Cached entries are keyed by token ID, so there is no cheap way to find
+	// just this user's; revoking a user is rare enough to drop them all.
+	d.cache.Purge()
+	return nil
+}
+
+func (d *Denylist) IsRevoked(ctx context.Context, claims *Claims) (bool, error) {
+	// Tokens without a jti (e.g. from an external provider) cannot be revoked
+	// individually or cached, but a user-wide revocation still applies.
+	if claims.ID == "" {
+		cutoff, err := userRevokedAt(ctx, d.redis, claims.UserID)
+		if err != nil {
+			return false, err
+		}
+		return !cutoff.IsZero() && issuedBefore(claims, cutoff), nil
+	}
+
+	if revoked, ok := d.cache.Get(claims.ID); ok {
+		return revoked, nil
+	}
+
+	values, err := d.redis.MGet(ctx, revokedTokenKeyPrefix+claims.ID, revokedUserKeyPrefix+claims.UserID).Result()
+	if err != nil {
+		return false, err
+	}
+
+	revoked := values[0] != nil
+	if !revoked && values[1] != nil {
+		cutoff, err := parseCutoff(values[1])
+		if err != nil {
+			return false, err
+		}
+		revoked = issuedBefore(claims, cutoff)
+	}
+
+	if revoked {
+		d.cache.Set(claims.ID, true, time.Until(claims.ExpiresAt.Time))
+	} else {
+		d.cache.Set(claims.ID, false, d.config.DenylistCacheTTL)
+	}
+	return revoked, nil
+}
+
+// userRevokedAt returns the user's revocation cutoff, or zero if none is set.
+func userRevokedAt(ctx context.Context, client *redis.Client, userID string) (time.Time, error) {
+	value, err := client.Get(ctx, revokedUserKeyPrefix+userID).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+
+	return parseCutoff(value)
+}
+
+// issuedBefore reports whether the token predates the cutoff. iat only has
+// one-second resolution, so a token from the cutoff's own second is let
+// through: otherwise logging in again right after a revocation would fail.
+func issuedBefore(claims *Claims, cutoff time.Time) bool {
+	return claims.IssuedAt == nil || claims.IssuedAt.Unix() < cutoff.Unix()
+}
+
+func parseCutoff(value interface{}) (time.Time, error) {
+	s, ok := value.(string)
+	if !ok {
+		return time.Time{}, errors.New("unexpected revocation cutoff type")
+	}
+	if cutoff, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return cutoff, nil
+	}
+	seconds, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(seconds, 0), nil
+}
@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/hsibAD/api-gateway/internal/config"
+)
+
+var testDenylistConfig = &config.AuthConfig{DenylistCacheSize: 10, DenylistCacheTTL: time.Hour}
+
+// testClaims are the claims of an access token with an hour left to live.
+// A zero issuedAt leaves out iat.
+func testClaims(id, userID string, issuedAt time.Time) *Claims {
+	claims := &Claims{
+		UserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        id,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+	if !issuedAt.IsZero() {
+		claims.IssuedAt = jwt.NewNumericDate(issuedAt)
+	}
+	return claims
+}
+
+func isRevoked(t *testing.T, d *Denylist, claims *Claims) bool {
+	t.Helper()
+	revoked, err := d.IsRevoked(context.Background(), claims)
+	if err != nil {
+		t.Fatalf("IsRevoked: %v", err)
+	}
+	return revoked
+}
+
+func TestDenylistRevokeToken(t *testing.T) {
+	ctx := context.Background()
+	d := NewDenylist(newTestRedis(t), testDenylistConfig)
+	claims := testClaims("t1", "u1", time.Now())
+
+	if isRevoked(t, d, claims) {
+		t.Fatalf("fresh token revoked")
+	}
+	if err := d.RevokeToken(ctx, claims); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+	if !isRevoked(t, d, claims) {
+		t.Errorf("revoked token accepted")
+	}
+	if isRevoked(t, d, testClaims("t2", "u1", time.Now())) {
+		t.Errorf("another token of the same user revoked")
+	}
+
+	if err := d.RevokeToken(ctx, testClaims("", "u1", time.Now())); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("RevokeToken without a jti error = %v, want ErrInvalidToken", err)
+	}
+	expired := testClaims("t3", "u1", time.Now())
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	if err := d.RevokeToken(ctx, expired); err != nil {
+		t.Errorf("RevokeToken of an expired token: %v", err)
+	}
+}
+
+func TestDenylistRevokeUser(t *testing.T) {
+	d := NewDenylist(newTestRedis(t), testDenylistConfig)
+	before := time.Now().Add(-10 * time.Second)
+
+	if err := d.RevokeUser(context.Background(), "u1"); err != nil {
+		t.Fatalf("RevokeUser: %v", err)
+	}
+	// Issued after RevokeUser returned: a login right after the revocation,
+	// within the same second or the next.
+	after := time.Now()
+
+	tests := []struct {
+		name   string
+		claims *Claims
+		want   bool
+	}{
+		{"issued before", testClaims("t1", "u1", before), true},
+		{"issued right after", testClaims("t2", "u1", after), false},
+		{"without iat", testClaims("t3", "u1", time.Time{}), true},
+		{"without jti, issued before", testClaims("", "u1", before), true},
+		{"without jti, issued right after", testClaims("", "u1", after), false},
+		{"another user", testClaims("t4", "u2", before), false},
+		{"another user without jti", testClaims("", "u2", before), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRevoked(t, d, tt.claims); got != tt.want {
+				t.Errorf("revoked = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Cutoffs stored as Unix seconds, before they carried nanoseconds, still
+// apply.
+func TestDenylistUnixCutoff(t *testing.T) {
+	client := newTestRedis(t)
+	d := NewDenylist(client, testDenylistConfig)
+	cutoff := time.Now().Add(-time.Minute)
+	if err := client.Set(context.Background(), revokedUserKeyPrefix+"u1", strconv.FormatInt(cutoff.Unix(), 10), 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !isRevoked(t, d, testClaims("t1", "u1", cutoff.Add(-time.Minute))) {
+		t.Errorf("token issued before the cutoff accepted")
+	}
+	if isRevoked(t, d, testClaims("t2", "u1", time.Now())) {
+		t.Errorf("token issued after the cutoff revoked")
+	}
+}
+
+func TestDenylistCache(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	newInstance := func() *Denylist {
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		t.Cleanup(func() { client.Close() })
+		return NewDenylist(client, testDenylistConfig)
+	}
+	d, other := newInstance(), newInstance()
+	valid, revoked := testClaims("t1", "u1", time.Now()), testClaims("t2", "u1", time.Now())
+
+	isRevoked(t, d, valid)
+	if err := d.RevokeToken(ctx, revoked); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+
+	// Both answers now come from the cache, even with Redis failing.
+	server.SetError("ERR unavailable")
+	if isRevoked(t, d, valid) {
+		t.Errorf("cached valid token reported revoked")
+	}
+	if !isRevoked(t, d, revoked) {
+		t.Errorf("cached revoked token reported valid")
+	}
+	if _, err := other.IsRevoked(ctx, valid); err == nil {
+		t.Errorf("IsRevoked without a cache entry or Redis succeeded")
+	}
+	server.SetError("")
+
+	// A revocation on another instance is seen once the cached "valid"
+	// answer expires.
+	if err := other.RevokeToken(ctx, valid); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+	if isRevoked(t, d, valid) {
+		t.Fatalf("cached valid answer not used")
+	}
+	expireCacheEntry(d.cache, valid.ID)
+	if !isRevoked(t, d, valid) {
+		t.Errorf("revocation elsewhere not seen after the cache entry expired")
+	}
+
+	// Revoking a user drops every cached answer, so it applies at once.
+	fresh := testClaims("t3", "u1", time.Now().Add(-time.Minute))
+	isRevoked(t, d, fresh)
+	if err := d.RevokeUser(ctx, "u1"); err != nil {
+		t.Fatalf("RevokeUser: %v", err)
+	}
+	if !isRevoked(t, d, fresh) {
+		t.Errorf("cached valid answer outlived RevokeUser")
+	}
+}
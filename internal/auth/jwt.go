@@ -1,14 +1,17 @@
 package auth
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/hsibAD/api-gateway/internal/config"
+	"github.com/hsibAD/api-gateway/internal/problem"
 )
 
 var (
@@ -17,41 +20,121 @@ var (
 )
 
 type Claims struct {
-	UserID string `json:"user_id"`
-	Role   string `json:"role"`
+	UserID string   `json:"user_id"`
+	Role   string   `json:"role"`
+	Scopes []string `json:"scopes,omitempty"`
 	jwt.RegisteredClaims
 }
 
 type JWTAuth struct {
-	config *config.AuthConfig
+	config   *config.AuthConfig
+	denylist *Denylist
+	apiKeys  *APIKeyStore
+	oidc     *OIDCVerifier
+
+	mu   sync.RWMutex
+	keys *KeySet
 }
 
-func NewJWTAuth(config *config.AuthConfig) *JWTAuth {
+func NewJWTAuth(config *config.AuthConfig, denylist *Denylist, apiKeys *APIKeyStore) (*JWTAuth, error) {
+	keys, err := loadKeySet(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var oidc *OIDCVerifier
+	if config.OIDC.Issuer != "" {
+		// Without an audience check any token the SSO issued for another
+		// application would be accepted here.
+		if config.OIDC.Audience == "" {
+			return nil, errors.New("OIDC audience is required when an issuer is configured")
+		}
+		oidc = NewOIDCVerifier(&config.OIDC)
+	}
+
 	return &JWTAuth{
-		config: config,
+		config:   config,
+		denylist: denylist,
+		apiKeys:  apiKeys,
+		oidc:     oidc,
+		keys:     keys,
+	}, nil
+}
+
+// ReloadKeys re-reads the configured key set and swaps it in. On failure the
+// current keys stay in place, so a bad key file never locks users out.
+func (j *JWTAuth) ReloadKeys() (*KeySet, error) {
+	keys, err := loadKeySet(j.config)
+	if err != nil {
+		return nil, err
 	}
+
+	j.mu.Lock()
+	j.keys = keys
+	j.mu.Unlock()
+	return keys, nil
 }
 
-func (j *JWTAuth) GenerateToken(userID, role string) (string, error) {
+func (j *JWTAuth) KeySet() *KeySet {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.keys
+}
+
+// GenerateToken signs a token for the user and returns it with its expiry.
+func (j *JWTAuth) GenerateToken(userID, role string) (string, time.Time, error) {
+	tokenID, err := randomToken(16)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(j.config.TokenExpiration)
 	claims := &Claims{
 		UserID: userID,
 		Role:   role,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(j.config.TokenExpiration)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        tokenID,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(j.config.JWTSecret))
+	key := j.KeySet().Active()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(key.signKey)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
 }
 
-func (j *JWTAuth) ValidateToken(tokenString string) (*Claims, error) {
+// ValidateToken accepts tokens minted by the gateway and, when configured,
+// tokens from the external OIDC provider, told apart by their iss claim.
+func (j *JWTAuth) ValidateToken(ctx context.Context, tokenString string) (*Claims, error) {
+	if j.oidc != nil {
+		var unverified jwt.RegisteredClaims
+		if _, _, err := jwt.NewParser().ParseUnverified(tokenString, &unverified); err == nil && j.oidc.Handles(unverified.Issuer) {
+			return j.oidc.Verify(ctx, tokenString)
+		}
+	}
+
+	keys := j.KeySet()
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		// Tokens minted before kids were stamped carry none; check them
+		// against the active key.
+		key := keys.Active()
+		if kid, ok := token.Header["kid"]; ok {
+			id, _ := kid.(string)
+			if key, ok = keys.Lookup(id); !ok {
+				return nil, ErrInvalidToken
+			}
+		}
+		if token.Method.Alg() != key.Method.Alg() {
 			return nil, ErrInvalidToken
 		}
-		return []byte(j.config.JWTSecret), nil
+		return key.verifyKey, nil
 	})
 
 	if err != nil {
@@ -68,50 +151,89 @@ func (j *JWTAuth) ValidateToken(tokenString string) (*Claims, error) {
 	return nil, ErrInvalidToken
 }
 
+// JWKS returns the public keys downstream services can verify our tokens with.
+func (j *JWTAuth) JWKS() JWKS {
+	return j.KeySet().JWKS()
+}
+
+// Middleware authenticates the request with either a Bearer token or, for
+// machine clients, an X-API-Key header.
 func (j *JWTAuth) Middleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if apiKey := c.GetHeader("X-API-Key"); apiKey != "" && j.apiKeys != nil {
+			j.authenticateAPIKey(c, apiKey)
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authorization header is required"})
+			RecordFailure(FailureMissingCredentials)
+			problem.Abort(c, http.StatusUnauthorized, "authorization header is required")
 			return
 		}
 
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid authorization header format"})
+			RecordFailure(FailureMalformedHeader)
+			problem.Abort(c, http.StatusUnauthorized, "invalid authorization header format")
 			return
 		}
 
-		claims, err := j.ValidateToken(parts[1])
+		claims, err := j.ValidateToken(c.Request.Context(), parts[1])
 		if err != nil {
 			if errors.Is(err, ErrExpiredToken) {
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token has expired"})
+				RecordFailure(FailureExpiredToken)
+				problem.Abort(c, http.StatusUnauthorized, "token has expired")
 				return
 			}
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			RecordFailure(FailureInvalidToken)
+			problem.Abort(c, http.StatusUnauthorized, "invalid token")
+			return
+		}
+
+		revoked, err := j.denylist.IsRevoked(c.Request.Context(), claims)
+		if err != nil {
+			RecordFailure(FailureCheckFailed)
+			problem.Abort(c, http.StatusServiceUnavailable, "token revocation check failed")
+			return
+		}
+		if revoked {
+			RecordFailure(FailureRevokedToken)
+			problem.Abort(c, http.StatusUnauthorized, "token has been revoked")
 			return
 		}
 
 		// Set user information in context
 		c.Set("user_id", claims.UserID)
 		c.Set("role", claims.Role)
+		c.Set("scopes", claims.Scopes)
+		c.Set("claims", claims)
 		c.Next()
 	}
 }
 
-func (j *JWTAuth) AdminOnly() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		role, exists := c.Get("role")
-		if !exists {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+func (j *JWTAuth) authenticateAPIKey(c *gin.Context, rawKey string) {
+	key, err := j.apiKeys.Authenticate(c.Request.Context(), rawKey)
+	if err != nil {
+		if errors.Is(err, ErrInvalidAPIKey) {
+			RecordFailure(FailureInvalidAPIKey)
+			problem.Abort(c, http.StatusUnauthorized, "invalid API key")
 			return
 		}
+		RecordFailure(FailureCheckFailed)
+		problem.Abort(c, http.StatusServiceUnavailable, "API key check failed")
+		return
+	}
 
-		if role != "admin" {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin access required"})
-			return
-		}
+	c.Set("user_id", key.OwnerID)
+	c.Set("role", key.Role)
+	c.Set("scopes", key.Scopes)
+	c.Set("api_key_id", key.ID)
+	c.Next()
+}
 
-		c.Next()
+func (j *JWTAuth) Close() {
+	if j.oidc != nil {
+		j.oidc.Close()
 	}
-} 
\ No newline at end of file
+}
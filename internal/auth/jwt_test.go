@@ -0,0 +1,233 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/hsibAD/api-gateway/internal/config"
+)
+
+// writeECKey writes a new P-256 private key as PEM and returns its path.
+func writeECKey(t *testing.T) string {
+	t.Helper()
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newTestJWTAuth(t *testing.T, keys ...config.SigningKeyConfig) *JWTAuth {
+	t.Helper()
+	j, err := NewJWTAuth(&config.AuthConfig{
+		JWTSecret:       "0123456789abcdef0123456789abcdef",
+		SigningKeys:     keys,
+		TokenExpiration: time.Minute,
+	}, nil, nil)
+	if err != nil {
+		t.Fatalf("NewJWTAuth: %v", err)
+	}
+	return j
+}
+
+// signTestToken signs claims for a user with key, stamping kid unless it
+// is empty.
+func signTestToken(t *testing.T, method jwt.SigningMethod, key interface{}, kid string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, &Claims{
+		UserID: "user-1",
+		Role:   "user",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	return signed
+}
+
+func TestValidateTokenAsymmetric(t *testing.T) {
+	j := newTestJWTAuth(t, config.SigningKeyConfig{ID: "ec", Algorithm: "ES256", KeyFile: writeECKey(t)})
+
+	token, _, err := j.GenerateToken("user-1", "admin")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	claims, err := j.ValidateToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if claims.UserID != "user-1" || claims.Role != "admin" {
+		t.Errorf("claims = %q/%q, want user-1/admin", claims.UserID, claims.Role)
+	}
+
+	jwks := j.JWKS()
+	if len(jwks.Keys) != 1 || jwks.Keys[0].KeyID != "ec" || jwks.Keys[0].KeyType != "EC" {
+		t.Errorf("JWKS = %+v, want the single EC key", jwks.Keys)
+	}
+}
+
+func TestValidateTokenAlgorithmMismatch(t *testing.T) {
+	keyFile := writeECKey(t)
+	j := newTestJWTAuth(t,
+		config.SigningKeyConfig{ID: "ec", Algorithm: "ES256", KeyFile: keyFile},
+		config.SigningKeyConfig{ID: "hs"},
+	)
+	ec, _ := j.KeySet().Lookup("ec")
+	der, err := x509.MarshalPKIXPublicKey(ec.verifyKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		// The classic confusion: an HMAC keyed with the published public key.
+		{"HS256 under an EC kid", signTestToken(t, jwt.SigningMethodHS256, public, "ec")},
+		{"ES256 under an HMAC kid", signTestToken(t, jwt.SigningMethodES256, ec.signKey, "hs")},
+		{"HS384 under an HS256 kid", signTestToken(t, jwt.SigningMethodHS384, []byte("0123456789abcdef0123456789abcdef"), "hs")},
+		{"alg none", signTestToken(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "ec")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := j.ValidateToken(context.Background(), tt.token); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("ValidateToken error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestJWKSOmitsHMACKeys(t *testing.T) {
+	j := newTestJWTAuth(t,
+		config.SigningKeyConfig{ID: "hs"},
+		config.SigningKeyConfig{ID: "ec", Algorithm: "ES256", KeyFile: writeECKey(t)},
+	)
+	for _, key := range j.JWKS().Keys {
+		if key.KeyID == "hs" {
+			t.Fatalf("JWKS publishes the HMAC key")
+		}
+	}
+}
+
+func TestValidateTokenKeyLookup(t *testing.T) {
+	j := newTestJWTAuth(t,
+		config.SigningKeyConfig{ID: "new", Algorithm: "ES256", KeyFile: writeECKey(t)},
+		config.SigningKeyConfig{ID: "old", Algorithm: "ES256", KeyFile: writeECKey(t)},
+	)
+	active, _ := j.KeySet().Lookup("new")
+	old, _ := j.KeySet().Lookup("old")
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"active key", signTestToken(t, jwt.SigningMethodES256, active.signKey, "new"), true},
+		{"older key by kid", signTestToken(t, jwt.SigningMethodES256, old.signKey, "old"), true},
+		{"no kid, active key", signTestToken(t, jwt.SigningMethodES256, active.signKey, ""), true},
+		{"no kid, older key", signTestToken(t, jwt.SigningMethodES256, old.signKey, ""), false},
+		{"kid of another key", signTestToken(t, jwt.SigningMethodES256, old.signKey, "new"), false},
+		{"unknown kid", signTestToken(t, jwt.SigningMethodES256, active.signKey, "gone"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := j.ValidateToken(context.Background(), tt.token)
+			if tt.valid && err != nil {
+				t.Errorf("ValidateToken: %v", err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("ValidateToken error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+
+	token, _, err := j.GenerateToken("user-1", "user")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+	if err != nil {
+		t.Fatalf("ParseUnverified: %v", err)
+	}
+	if kid := parsed.Header["kid"]; kid != "new" {
+		t.Errorf("GenerateToken stamped kid %v, want the active key", kid)
+	}
+}
+
+func TestReloadKeys(t *testing.T) {
+	dir := t.TempDir()
+	first, second := writeECKey(t), writeECKey(t)
+	keySetFile := filepath.Join(dir, "keys.json")
+	writeKeySet := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(keySetFile, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeKeySet(`[{"kid": "first", "alg": "ES256", "key_file": "` + first + `"}]`)
+	j, err := NewJWTAuth(&config.AuthConfig{KeySetFile: keySetFile, TokenExpiration: time.Minute}, nil, nil)
+	if err != nil {
+		t.Fatalf("NewJWTAuth: %v", err)
+	}
+	before, _, err := j.GenerateToken("user-1", "user")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	// Promote a new key while the old one still verifies.
+	writeKeySet(`[{"kid": "second", "alg": "ES256", "key_file": "` + second + `"},
+		{"kid": "first", "alg": "ES256", "key_file": "` + first + `"}]`)
+	if _, err := j.ReloadKeys(); err != nil {
+		t.Fatalf("ReloadKeys: %v", err)
+	}
+	if _, err := j.ValidateToken(context.Background(), before); err != nil {
+		t.Errorf("token of the demoted key: %v", err)
+	}
+	if active := j.KeySet().Active().ID; active != "second" {
+		t.Errorf("active key = %q, want second", active)
+	}
+
+	// A broken key set keeps the current keys.
+	writeKeySet(`not json`)
+	if _, err := j.ReloadKeys(); err == nil {
+		t.Errorf("ReloadKeys accepted a broken key set")
+	}
+	if ids := j.KeySet().IDs(); len(ids) != 2 {
+		t.Errorf("keys after a failed reload = %v, want both", ids)
+	}
+
+	// Retiring the old key rejects its tokens.
+	writeKeySet(`[{"kid": "second", "alg": "ES256", "key_file": "` + second + `"}]`)
+	if _, err := j.ReloadKeys(); err != nil {
+		t.Fatalf("ReloadKeys: %v", err)
+	}
+	if _, err := j.ValidateToken(context.Background(), before); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("token of the retired key error = %v, want ErrInvalidToken", err)
+	}
+}
@@ -0,0 +1,247 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is one JWT key identified by its kid. For HMAC the same secret
+// signs and verifies; for asymmetric algorithms only the public half is ever
+// published.
+type SigningKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// JWK is a public key in RFC 7517 form.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func NewHMACKey(id string, secret []byte) *SigningKey {
+	return &SigningKey{
+		ID:        id,
+		Method:    jwt.SigningMethodHS256,
+		signKey:   secret,
+		verifyKey: secret,
+	}
+}
+
+// CanSign reports whether the private half is available.
+func (k *SigningKey) CanSign() bool {
+	return k.signKey != nil
+}
+
+// LoadSigningKey reads a PEM encoded key for the given algorithm. A private
+// key can sign and verify; a public key is only good for verification.
+// An empty id defaults to the RFC 7638 thumbprint of the public key.
+func LoadSigningKey(id, algorithm, path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key %s: %w", path, err)
+	}
+
+	method := jwt.GetSigningMethod(algorithm)
+	if method == nil {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+
+	key := &SigningKey{ID: id, Method: method}
+	switch method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		if private, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+			key.signKey, key.verifyKey = private, &private.PublicKey
+		} else if key.verifyKey, err = jwt.ParseRSAPublicKeyFromPEM(data); err != nil {
+			return nil, fmt.Errorf("failed to parse RSA key %s: %w", path, err)
+		}
+	case *jwt.SigningMethodECDSA:
+		var public *ecdsa.PublicKey
+		if private, err := jwt.ParseECPrivateKeyFromPEM(data); err == nil {
+			key.signKey, public = private, &private.PublicKey
+		} else if public, err = jwt.ParseECPublicKeyFromPEM(data); err != nil {
+			return nil, fmt.Errorf("failed to parse EC key %s: %w", path, err)
+		}
+		if public.Curve.Params().BitSize != method.(*jwt.SigningMethodECDSA).CurveBits {
+			return nil, fmt.Errorf("EC key %s does not match %s", path, algorithm)
+		}
+		key.verifyKey = public
+	case *jwt.SigningMethodEd25519:
+		if private, err := jwt.ParseEdPrivateKeyFromPEM(data); err == nil {
+			key.signKey, key.verifyKey = private, private.(ed25519.PrivateKey).Public()
+		} else if key.verifyKey, err = jwt.ParseEdPublicKeyFromPEM(data); err != nil {
+			return nil, fmt.Errorf("failed to parse Ed25519 key %s: %w", path, err)
+		}
+	case *jwt.SigningMethodHMAC:
+		secret := bytes.TrimSpace(data)
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("HMAC secret file %s is empty", path)
+		}
+		if id == "" {
+			return nil, fmt.Errorf("HMAC key %s needs an explicit kid", path)
+		}
+		key.signKey, key.verifyKey = secret, secret
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+
+	if key.ID == "" {
+		jwk, _ := key.JWK()
+		key.ID = jwk.thumbprint()
+	}
+	return key, nil
+}
+
+// JWK returns the public half of the key. It reports false for HMAC keys,
+// which must never be published.
+func (k *SigningKey) JWK() (JWK, bool) {
+	jwk := JWK{KeyID: k.ID, Use: "sig", Algorithm: k.Method.Alg()}
+
+	switch public := k.verifyKey.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = encodeSegment(public.N.Bytes())
+		jwk.E = encodeSegment(big.NewInt(int64(public.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (public.Curve.Params().BitSize + 7) / 8
+		jwk.KeyType = "EC"
+		jwk.Curve = public.Curve.Params().Name
+		jwk.X = encodeSegment(public.X.FillBytes(make([]byte, size)))
+		jwk.Y = encodeSegment(public.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = encodeSegment(public)
+	}
+
+	if jwk.KeyType == "" {
+		return JWK{}, false
+	}
+	return jwk, true
+}
+
+// thumbprint implements RFC 7638: the SHA-256 of the required members in
+// lexicographic order.
+func (j JWK) thumbprint() string {
+	var members interface{}
+	switch j.KeyType {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{j.E, j.KeyType, j.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{j.Curve, j.KeyType, j.X, j.Y}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{j.Curve, j.KeyType, j.X}
+	}
+
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return encodeSegment(sum[:])
+}
+
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// PublicKey decodes the JWK into a key usable for signature verification.
+func (j JWK) PublicKey() (interface{}, error) {
+	switch j.KeyType {
+	case "RSA":
+		n, err := decodeSegment(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeSegment(j.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch j.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported EC curve %q", j.Curve)
+		}
+		x, err := decodeSegment(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeSegment(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		public := &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !curve.IsOnCurve(public.X, public.Y) {
+			return nil, fmt.Errorf("EC key %q is not on curve %s", j.KeyID, j.Curve)
+		}
+		return public, nil
+	case "OKP":
+		if j.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported OKP curve %q", j.Curve)
+		}
+		x, err := decodeSegment(j.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key length %d", len(x))
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", j.KeyType)
+	}
+}
+
+func decodeSegment(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/hsibAD/api-gateway/internal/config"
+)
+
+// KeySet is an immutable, ordered collection of signing keys. The first key
+// signs new tokens; every key verifies tokens stamped with its kid, which is
+// what lets a new key be introduced before it is promoted and an old one be
+// retired only after its tokens have expired.
+type KeySet struct {
+	keys []*SigningKey
+	byID map[string]*SigningKey
+}
+
+func NewKeySet(keys []*SigningKey) (*KeySet, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("key set is empty")
+	}
+	if !keys[0].CanSign() {
+		return nil, fmt.Errorf("active key %q has no private key", keys[0].ID)
+	}
+
+	byID := make(map[string]*SigningKey, len(keys))
+	for _, key := range keys {
+		if _, exists := byID[key.ID]; exists {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		byID[key.ID] = key
+	}
+
+	return &KeySet{
+		keys: keys,
+		byID: byID,
+	}, nil
+}
+
+func (ks *KeySet) Active() *SigningKey {
+	return ks.keys[0]
+}
+
+func (ks *KeySet) Lookup(kid string) (*SigningKey, bool) {
+	key, ok := ks.byID[kid]
+	return key, ok
+}
+
+func (ks *KeySet) IDs() []string {
+	ids := make([]string, len(ks.keys))
+	for i, key := range ks.keys {
+		ids[i] = key.ID
+	}
+	return ids
+}
+
+func (ks *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		if jwk, ok := key.JWK(); ok {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+	return jwks
+}
+
+// loadKeySet builds the key set from KeySetFile if configured, otherwise
+// from SigningKeys. Key files are read fresh on every call.
+func loadKeySet(cfg *config.AuthConfig) (*KeySet, error) {
+	entries := cfg.SigningKeys
+	if cfg.KeySetFile != "" {
+		data, err := os.ReadFile(cfg.KeySetFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key set %s: %w", cfg.KeySetFile, err)
+		}
+		entries = nil
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, fmt.Errorf("failed to parse key set %s: %w", cfg.KeySetFile, err)
+		}
+	}
+
+	keys := make([]*SigningKey, 0, len(entries))
+	for _, entry := range entries {
+		key, err := loadKey(cfg, entry)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return NewKeySet(keys)
+}
+
+func loadKey(cfg *config.AuthConfig, entry config.SigningKeyConfig) (*SigningKey, error) {
+	if entry.Algorithm == "" || entry.Algorithm == jwt.SigningMethodHS256.Alg() {
+		if entry.KeyFile == "" {
+			id := entry.ID
+			if id == "" {
+				id = "default"
+			}
+			return NewHMACKey(id, []byte(cfg.JWTSecret)), nil
+		}
+		return LoadSigningKey(entry.ID, jwt.SigningMethodHS256.Alg(), entry.KeyFile)
+	}
+	return LoadSigningKey(entry.ID, entry.Algorithm, entry.KeyFile)
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// expireCacheEntry makes the entry for key expire now.
+func expireCacheEntry(c *lruCache, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*lruEntry).expiresAt = time.Now().Add(-time.Second)
+	}
+}
+
+func TestLRUCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newLRUCache(2)
+	c.Set("a", true, time.Hour)
+	c.Set("b", false, time.Hour)
+	c.Get("a") // b is now the least recently used
+	c.Set("c", true, time.Hour)
+
+	if _, ok := c.Get("b"); ok {
+		t.Errorf("b kept over capacity, want it evicted")
+	}
+	if value, ok := c.Get("a"); !ok || !value {
+		t.Errorf("Get(a) = %v, %v, want true, true", value, ok)
+	}
+	if value, ok := c.Get("c"); !ok || !value {
+		t.Errorf("Get(c) = %v, %v, want true, true", value, ok)
+	}
+}
+
+func TestLRUCacheExpiry(t *testing.T) {
+	c := newLRUCache(2)
+	c.Set("a", true, time.Hour)
+	expireCacheEntry(c, "a")
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("expired entry returned")
+	}
+	if c.order.Len() != 0 {
+		t.Errorf("expired entry kept after Get, %d entries", c.order.Len())
+	}
+
+	// Setting an existing key replaces its value and expiry.
+	c.Set("b", false, time.Hour)
+	expireCacheEntry(c, "b")
+	c.Set("b", true, time.Hour)
+	if value, ok := c.Get("b"); !ok || !value {
+		t.Errorf("Get(b) after overwrite = %v, %v, want true, true", value, ok)
+	}
+}
+
+func TestLRUCacheDisabled(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int
+		ttl      time.Duration
+	}{
+		{"zero capacity", 0, time.Hour},
+		{"zero ttl", 2, 0},
+		{"negative ttl", 2, -time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newLRUCache(tt.capacity)
+			c.Set("a", true, tt.ttl)
+			if _, ok := c.Get("a"); ok {
+				t.Errorf("entry cached")
+			}
+		})
+	}
+}
+
+func TestLRUCachePurge(t *testing.T) {
+	c := newLRUCache(2)
+	c.Set("a", true, time.Hour)
+	c.Set("b", true, time.Hour)
+	c.Purge()
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("entry survived Purge")
+	}
+	c.Set("c", true, time.Hour)
+	if _, ok := c.Get("c"); !ok {
+		t.Errorf("cache unusable after Purge")
+	}
+}
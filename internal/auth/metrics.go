@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Reasons an authentication or authorization attempt is rejected. They are
+// the only values of the reason label.
+const (
+	FailureMissingCredentials  = "missing_credentials"
+	FailureMalformedHeader     = "malformed_header"
+	FailureExpiredToken        = "expired_token"
+	FailureInvalidToken        = "invalid_token"
+	FailureRevokedToken        = "revoked_token"
+	FailureInvalidAPIKey       = "invalid_api_key"
+	FailureCheckFailed         = "check_failed"
+	FailurePermissionDenied    = "permission_denied"
+	FailureInvalidCredentials  = "invalid_credentials"
+	FailureInvalidRefreshToken = "invalid_refresh_token"
+	FailureRefreshTokenReused  = "refresh_token_reused"
+)
+
+var authFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gateway_auth_failures_total",
+	Help: "Rejected authentication and authorization attempts, by reason.",
+}, []string{"reason"})
+
+// RecordFailure counts a rejected attempt. reason is one of the Failure
+// constants.
+func RecordFailure(reason string) {
+	authFailures.WithLabelValues(reason).Inc()
+}
@@ -0,0 +1,285 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/hsibAD/api-gateway/internal/config"
+)
+
+// minKeyRefreshInterval throttles the on-demand JWKS fetch triggered by an
+// unknown kid, so a flood of forged tokens cannot hammer the provider. It
+// counts from the last attempt, so a provider that is down or slow is not
+// asked again either.
+const minKeyRefreshInterval = 30 * time.Second
+
+type oidcDiscovery struct {
+	Issuer  string `json:"issuer"`
+	JWKSURI string `json:"jwks_uri"`
+}
+
+// OIDCVerifier validates tokens minted by an external OpenID Connect
+// provider. Discovery metadata and signing keys are fetched lazily, cached,
+// and refreshed in the background every RefreshInterval.
+type OIDCVerifier struct {
+	config *config.OIDCConfig
+	client *http.Client
+
+	mu          sync.RWMutex
+	jwksURI     string
+	keys        map[string]interface{}
+	lastRefresh time.Time
+
+	// refreshMu serialises fetches and guards lastAttempt, the start of the
+	// last fetch whether or not it succeeded.
+	refreshMu   sync.Mutex
+	lastAttempt time.Time
+	stop        chan struct{}
+}
+
+func NewOIDCVerifier(config *config.OIDCConfig) *OIDCVerifier {
+	v := &OIDCVerifier{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+		keys:   make(map[string]interface{}),
+		stop:   make(chan struct{}),
+	}
+	go v.refreshLoop()
+	return v
+}
+
+// Handles reports whether a token claims to come from this provider.
+func (v *OIDCVerifier) Handles(issuer string) bool {
+	return issuer != "" && issuer == v.config.Issuer
+}
+
+func (v *OIDCVerifier) Verify(ctx context.Context, tokenString string) (*Claims, error) {
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return v.key(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(v.config.Issuer),
+		jwt.WithAudience(v.config.Audience),
+		jwt.WithLeeway(v.config.ClockSkew),
+	)
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrExpiredToken
+		}
+		return nil, ErrInvalidToken
+	}
+	if !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	// The parser only checks exp when present; provider tokens must carry it.
+	expiresAt, err := claims.GetExpirationTime()
+	if err != nil || expiresAt == nil {
+		return nil, ErrInvalidToken
+	}
+
+	userID, _ := lookupClaim(claims, v.config.UserIDClaim).(string)
+	if userID == "" {
+		return nil, ErrInvalidToken
+	}
+
+	role := v.config.DefaultRole
+	switch value := lookupClaim(claims, v.config.RoleClaim).(type) {
+	case string:
+		role = value
+	case []interface{}:
+		if len(value) > 0 {
+			if first, ok := value[0].(string); ok {
+				role = first
+			}
+		}
+	}
+
+	// OAuth scopes arrive as one space-delimited string. Only the ones shaped
+	// like gateway permissions narrow access; "openid", "email" etc. do not.
+	var scopes []string
+	if scope, ok := claims["scope"].(string); ok {
+		for _, s := range strings.Fields(scope) {
+			if strings.Contains(s, ":") {
+				scopes = append(scopes, s)
+			}
+		}
+	}
+
+	issuedAt, _ := claims.GetIssuedAt()
+	subject, _ := claims.GetSubject()
+	audience, _ := claims.GetAudience()
+	tokenID, _ := claims["jti"].(string)
+
+	return &Claims{
+		UserID: userID,
+		Role:   role,
+		Scopes: scopes,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			Issuer:    v.config.Issuer,
+			Subject:   subject,
+			Audience:  audience,
+			ExpiresAt: expiresAt,
+			IssuedAt:  issuedAt,
+		},
+	}, nil
+}
+
+func (v *OIDCVerifier) Close() {
+	close(v.stop)
+}
+
+func (v *OIDCVerifier) key(ctx context.Context, kid string) (interface{}, error) {
+	if key, ok := v.cachedKey(kid); ok {
+		return key, nil
+	}
+
+	// Unknown kid: the provider may have rotated, so refetch once.
+	if err := v.refreshIfStale(ctx); err != nil {
+		return nil, err
+	}
+
+	if key, ok := v.cachedKey(kid); ok {
+		return key, nil
+	}
+	return nil, ErrInvalidToken
+}
+
+func (v *OIDCVerifier) cachedKey(kid string) (interface{}, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	// Providers that publish a single key may omit kid from their tokens.
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, true
+		}
+	}
+	key, ok := v.keys[kid]
+	return key, ok
+}
+
+func (v *OIDCVerifier) refreshLoop() {
+	ticker := time.NewTicker(v.config.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), v.client.Timeout)
+		if err := v.refresh(ctx); err != nil {
+			fmt.Printf("Failed to refresh OIDC keys from %s: %v\n", v.config.Issuer, err)
+		}
+		cancel()
+
+		select {
+		case <-ticker.C:
+		case <-v.stop:
+			return
+		}
+	}
+}
+
+func (v *OIDCVerifier) refresh(ctx context.Context) error {
+	v.refreshMu.Lock()
+	defer v.refreshMu.Unlock()
+	return v.fetch(ctx)
+}
+
+func (v *OIDCVerifier) refreshIfStale(ctx context.Context) error {
+	v.refreshMu.Lock()
+	defer v.refreshMu.Unlock()
+
+	if time.Since(v.lastAttempt) < minKeyRefreshInterval {
+		return nil
+	}
+	return v.fetch(ctx)
+}
+
+// fetch must be called with refreshMu held.
+func (v *OIDCVerifier) fetch(ctx context.Context) error {
+	v.lastAttempt = time.Now()
+
+	v.mu.RLock()
+	jwksURI := v.jwksURI
+	v.mu.RUnlock()
+
+	if jwksURI == "" {
+		var discovery oidcDiscovery
+		discoveryURL := strings.TrimSuffix(v.config.Issuer, "/") + "/.well-known/openid-configuration"
+		if err := v.getJSON(ctx, discoveryURL, &discovery); err != nil {
+			return fmt.Errorf("discovery failed: %w", err)
+		}
+		if discovery.Issuer != v.config.Issuer {
+			return fmt.Errorf("discovery issuer %q does not match configured issuer", discovery.Issuer)
+		}
+		if discovery.JWKSURI == "" {
+			return errors.New("discovery document has no jwks_uri")
+		}
+		jwksURI = discovery.JWKSURI
+	}
+
+	var jwks JWKS
+	if err := v.getJSON(ctx, jwksURI, &jwks); err != nil {
+		return fmt.Errorf("fetching JWKS failed: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			// Skip keys we cannot use rather than dropping the whole set.
+			continue
+		}
+		keys[jwk.KeyID] = key
+	}
+
+	v.mu.Lock()
+	v.jwksURI = jwksURI
+	v.keys = keys
+	v.lastRefresh = time.Now()
+	v.mu.Unlock()
+	return nil
+}
+
+func (v *OIDCVerifier) getJSON(ctx context.Context, url string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// lookupClaim resolves a dotted path such as "realm_access.roles".
+func lookupClaim(claims jwt.MapClaims, path string) interface{} {
+	var current interface{} = map[string]interface{}(claims)
+	for _, part := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = object[part]
+	}
+	return current
+}
@@ -0,0 +1,299 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/hsibAD/api-gateway/internal/config"
+)
+
+// testIssuer is a minimal OpenID provider: a discovery document and a JWKS
+// whose keys the test can rotate.
+type testIssuer struct {
+	server *httptest.Server
+
+	mu             sync.Mutex
+	keys           []*SigningKey
+	failing        bool
+	discoveryCalls int
+	jwksCalls      int
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	issuer := &testIssuer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		issuer.mu.Lock()
+		issuer.discoveryCalls++
+		issuer.mu.Unlock()
+		json.NewEncoder(w).Encode(oidcDiscovery{Issuer: issuer.server.URL, JWKSURI: issuer.server.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		issuer.mu.Lock()
+		defer issuer.mu.Unlock()
+		issuer.jwksCalls++
+		if issuer.failing {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		jwks := JWKS{Keys: []JWK{}}
+		for _, key := range issuer.keys {
+			jwk, _ := key.JWK()
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+		json.NewEncoder(w).Encode(jwks)
+	})
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+// rotate generates a new key, publishes it in place of the current ones and
+// returns it.
+func (i *testIssuer) rotate(t *testing.T, kid string) *SigningKey {
+	t.Helper()
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	key := &SigningKey{ID: kid, Method: jwt.SigningMethodES256, signKey: private, verifyKey: &private.PublicKey}
+
+	i.mu.Lock()
+	i.keys = []*SigningKey{key}
+	i.mu.Unlock()
+	return key
+}
+
+func (i *testIssuer) setFailing(failing bool) {
+	i.mu.Lock()
+	i.failing = failing
+	i.mu.Unlock()
+}
+
+func (i *testIssuer) calls() (discovery, jwks int) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.discoveryCalls, i.jwksCalls
+}
+
+func (i *testIssuer) verifier(t *testing.T) *OIDCVerifier {
+	t.Helper()
+	v := NewOIDCVerifier(&config.OIDCConfig{
+		Issuer:          i.server.URL,
+		Audience:        "gateway",
+		UserIDClaim:     "sub",
+		RoleClaim:       "realm_access.roles",
+		DefaultRole:     "user",
+		RefreshInterval: time.Hour,
+	})
+	t.Cleanup(v.Close)
+
+	// Let the background fetch at startup finish so fetch counts are exact.
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		v.mu.RLock()
+		fetched := !v.lastRefresh.IsZero()
+		v.mu.RUnlock()
+		if fetched {
+			return v
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("initial key fetch did not finish")
+		}
+	}
+}
+
+func (i *testIssuer) token(t *testing.T, key *SigningKey, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(key.signKey)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	return signed
+}
+
+func (i *testIssuer) claims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":          i.server.URL,
+		"aud":          "gateway",
+		"sub":          "user-1",
+		"exp":          time.Now().Add(time.Minute).Unix(),
+		"realm_access": map[string]interface{}{"roles": []string{"admin"}},
+		"scope":        "openid email orders:read",
+	}
+}
+
+func TestOIDCVerifierDiscovery(t *testing.T) {
+	issuer := newTestIssuer(t)
+	key := issuer.rotate(t, "k1")
+	v := issuer.verifier(t)
+
+	claims, err := v.Verify(context.Background(), issuer.token(t, key, issuer.claims()))
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if claims.UserID != "user-1" || claims.Role != "admin" {
+		t.Errorf("claims = %q/%q, want user-1/admin", claims.UserID, claims.Role)
+	}
+	if len(claims.Scopes) != 1 || claims.Scopes[0] != "orders:read" {
+		t.Errorf("scopes = %v, want [orders:read]", claims.Scopes)
+	}
+	if discovery, _ := issuer.calls(); discovery != 1 {
+		t.Errorf("discovery fetched %d times, want once", discovery)
+	}
+
+	withoutRole := issuer.claims()
+	delete(withoutRole, "realm_access")
+	claims, err = v.Verify(context.Background(), issuer.token(t, key, withoutRole))
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if claims.Role != "user" {
+		t.Errorf("role without the claim = %q, want the default", claims.Role)
+	}
+}
+
+func TestOIDCVerifierRefetchesOnUnknownKid(t *testing.T) {
+	issuer := newTestIssuer(t)
+	first := issuer.rotate(t, "k1")
+	v := issuer.verifier(t)
+	if _, err := v.Verify(context.Background(), issuer.token(t, first, issuer.claims())); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	_, before := issuer.calls()
+
+	second := issuer.rotate(t, "k2")
+	token := issuer.token(t, second, issuer.claims())
+
+	// Right after a fetch, an unknown kid does not trigger another.
+	if _, err := v.Verify(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Verify within the refresh throttle error = %v, want ErrInvalidToken", err)
+	}
+	if _, jwks := issuer.calls(); jwks != before {
+		t.Fatalf("JWKS fetched %d times within the throttle, want %d", jwks, before)
+	}
+
+	ageLastAttempt(v)
+	if _, err := v.Verify(context.Background(), token); err != nil {
+		t.Fatalf("Verify after rotation: %v", err)
+	}
+	if _, jwks := issuer.calls(); jwks != before+1 {
+		t.Errorf("JWKS fetched %d times, want %d", jwks, before+1)
+	}
+}
+
+// ageLastAttempt lets the next unknown kid trigger a fetch.
+func ageLastAttempt(v *OIDCVerifier) {
+	v.refreshMu.Lock()
+	v.lastAttempt = time.Now().Add(-minKeyRefreshInterval)
+	v.refreshMu.Unlock()
+}
+
+func TestOIDCVerifierThrottlesFailedFetches(t *testing.T) {
+	issuer := newTestIssuer(t)
+	issuer.rotate(t, "k1")
+	v := issuer.verifier(t)
+	_, before := issuer.calls()
+
+	issuer.setFailing(true)
+	token := issuer.token(t, issuer.rotate(t, "k2"), issuer.claims())
+	ageLastAttempt(v)
+
+	// A burst of tokens with an unknown kid while the provider fails.
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := v.Verify(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Verify while the provider fails error = %v, want ErrInvalidToken", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if _, jwks := issuer.calls(); jwks != before+1 {
+		t.Fatalf("JWKS fetched %d times while failing, want %d", jwks, before+1)
+	}
+
+	// Recovery is picked up once the interval has passed.
+	issuer.setFailing(false)
+	ageLastAttempt(v)
+	if _, err := v.Verify(context.Background(), token); err != nil {
+		t.Fatalf("Verify after recovery: %v", err)
+	}
+	if _, jwks := issuer.calls(); jwks != before+2 {
+		t.Errorf("JWKS fetched %d times, want %d", jwks, before+2)
+	}
+}
+
+func TestOIDCVerifierRejects(t *testing.T) {
+	issuer := newTestIssuer(t)
+	key := issuer.rotate(t, "k1")
+	v := issuer.verifier(t)
+
+	tests := []struct {
+		name   string
+		modify func(jwt.MapClaims)
+		want   error
+	}{
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }, ErrInvalidToken},
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "another-app" }, ErrInvalidToken},
+		{"missing exp", func(c jwt.MapClaims) { delete(c, "exp") }, ErrInvalidToken},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, ErrExpiredToken},
+		{"missing subject", func(c jwt.MapClaims) { delete(c, "sub") }, ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := issuer.claims()
+			tt.modify(claims)
+			if _, err := v.Verify(context.Background(), issuer.token(t, key, claims)); !errors.Is(err, tt.want) {
+				t.Errorf("Verify error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateTokenRoutesByIssuer(t *testing.T) {
+	issuer := newTestIssuer(t)
+	key := issuer.rotate(t, "k1")
+	j, err := NewJWTAuth(&config.AuthConfig{
+		JWTSecret:       "0123456789abcdef0123456789abcdef",
+		SigningKeys:     []config.SigningKeyConfig{{ID: "hs"}},
+		TokenExpiration: time.Minute,
+		OIDC: config.OIDCConfig{
+			Issuer:          issuer.server.URL,
+			Audience:        "gateway",
+			UserIDClaim:     "sub",
+			RoleClaim:       "role",
+			DefaultRole:     "user",
+			RefreshInterval: time.Hour,
+		},
+	}, nil, nil)
+	if err != nil {
+		t.Fatalf("NewJWTAuth: %v", err)
+	}
+	t.Cleanup(j.Close)
+
+	if _, err := j.ValidateToken(context.Background(), issuer.token(t, key, issuer.claims())); err != nil {
+		t.Errorf("provider token: %v", err)
+	}
+	own, _, err := j.GenerateToken("user-2", "user")
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	if _, err := j.ValidateToken(context.Background(), own); err != nil {
+		t.Errorf("gateway token: %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hsibAD/api-gateway/internal/config"
+	"github.com/hsibAD/api-gateway/internal/problem"
+)
+
+// Policy maps roles to the permissions they grant. Permissions are
+// "resource:action" strings; a grant of "resource:*" covers every action on
+// the resource and "*" covers everything.
+type Policy struct {
+	roles map[string][]string
+}
+
+func NewPolicy(roles map[string][]string) *Policy {
+	return &Policy{
+		roles: roles,
+	}
+}
+
+// LoadPolicy builds the policy from PolicyFile if set, otherwise from the
+// roles in the config.
+func LoadPolicy(cfg *config.RBACConfig) (*Policy, error) {
+	if cfg.PolicyFile == "" {
+		return NewPolicy(cfg.Roles), nil
+	}
+
+	data, err := os.ReadFile(cfg.PolicyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy %s: %w", cfg.PolicyFile, err)
+	}
+
+	var file struct {
+		Roles map[string][]string `json:"roles"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse policy %s: %w", cfg.PolicyFile, err)
+	}
+	return NewPolicy(file.Roles), nil
+}
+
+// Allows reports whether a principal may use the permission. A non-empty
+// scope list narrows what the role grants; it never widens it.
+func (p *Policy) Allows(role string, scopes []string, permission string) bool {
+	if !matchesAny(p.roles[role], permission) {
+		return false
+	}
+	return len(scopes) == 0 || matchesAny(scopes, permission)
+}
+
+// Require aborts with 403 unless the authenticated principal holds every
+// listed permission. It must run after JWTAuth.Middleware.
+func (p *Policy) Require(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, exists := c.Get("role"); !exists {
+			RecordFailure(FailureMissingCredentials)
+			problem.Abort(c, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		var missing []string
+		for _, permission := range permissions {
+			if !p.Granted(c, permission) {
+				missing = append(missing, permission)
+			}
+		}
+
+		if len(missing) > 0 {
+			RecordFailure(FailurePermissionDenied)
+			problem.AbortWithFields(c, http.StatusForbidden, "missing permission: "+strings.Join(missing, ", "), gin.H{
+				"missing_permissions": missing,
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// Granted reports whether the principal authenticated on the request holds
+// the permission.
+func (p *Policy) Granted(c *gin.Context, permission string) bool {
+	role := c.GetString("role")
+	scopes := c.GetStringSlice("scopes")
+	return role != "" && p.Allows(role, scopes, permission)
+}
+
+func matchesAny(grants []string, permission string) bool {
+	for _, grant := range grants {
+		if grant == "*" || grant == permission {
+			return true
+		}
+		if resource, ok := strings.CutSuffix(grant, ":*"); ok && strings.HasPrefix(permission, resource+":") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+var testPolicy = NewPolicy(map[string][]string{
+	"user":    {"orders:read", "orders:write", "payments:read", "payments:write"},
+	"support": {"orders:*", "payments:read"},
+	"admin":   {"*"},
+	"viewer":  {},
+})
+
+// newPolicyRouter guards a few routes like the server does. The caller's
+// role and comma-separated scopes come from the X-Test-Role and
+// X-Test-Scopes headers; without X-Test-Role the request is anonymous.
+func newPolicyRouter(p *Policy) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if role, ok := c.Request.Header["X-Test-Role"]; ok {
+			c.Set("role", role[0])
+			if scopes := c.GetHeader("X-Test-Scopes"); scopes != "" {
+				c.Set("scopes", strings.Split(scopes, ","))
+			}
+		}
+	})
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/orders", p.Require("orders:read"), ok)
+	router.POST("/orders", p.Require("orders:write"), ok)
+	router.PUT("/payments/:id/status", p.Require("payments:manage"), ok)
+	router.GET("/orders/:id/payments", p.Require("orders:read", "payments:read"), ok)
+	router.POST("/admin/api-keys", p.Require("api-keys:manage"), ok)
+	return router
+}
+
+func TestRequire(t *testing.T) {
+	router := newPolicyRouter(testPolicy)
+
+	tests := []struct {
+		role   string
+		scopes string
+		method string
+		path   string
+		want   int
+	}{
+		// Roles alone.
+		{"user", "", http.MethodGet, "/orders", http.StatusOK},
+		{"user", "", http.MethodPost, "/orders", http.StatusOK},
+		{"user", "", http.MethodPut, "/payments/p1/status", http.StatusForbidden},
+		{"user", "", http.MethodGet, "/orders/o1/payments", http.StatusOK},
+		{"user", "", http.MethodPost, "/admin/api-keys", http.StatusForbidden},
+		{"support", "", http.MethodPost, "/orders", http.StatusOK},
+		{"support", "", http.MethodGet, "/orders/o1/payments", http.StatusOK},
+		{"support", "", http.MethodPut, "/payments/p1/status", http.StatusForbidden},
+		{"admin", "", http.MethodPut, "/payments/p1/status", http.StatusOK},
+		{"admin", "", http.MethodPost, "/admin/api-keys", http.StatusOK},
+		{"viewer", "", http.MethodGet, "/orders", http.StatusForbidden},
+		{"unknown", "", http.MethodGet, "/orders", http.StatusForbidden},
+		{"", "", http.MethodGet, "/orders", http.StatusForbidden},
+
+		// Scopes narrow what the role grants.
+		{"user", "orders:read", http.MethodGet, "/orders", http.StatusOK},
+		{"user", "orders:read", http.MethodPost, "/orders", http.StatusForbidden},
+		{"user", "orders:*", http.MethodPost, "/orders", http.StatusOK},
+		{"user", "orders:read", http.MethodGet, "/orders/o1/payments", http.StatusForbidden},
+		{"user", "orders:read,payments:read", http.MethodGet, "/orders/o1/payments", http.StatusOK},
+		{"admin", "orders:read", http.MethodGet, "/orders", http.StatusOK},
+		{"admin", "orders:read", http.MethodPost, "/admin/api-keys", http.StatusForbidden},
+		{"admin", "*", http.MethodPost, "/admin/api-keys", http.StatusOK},
+
+		// They never widen it.
+		{"user", "payments:manage", http.MethodPut, "/payments/p1/status", http.StatusForbidden},
+		{"user", "*", http.MethodPost, "/admin/api-keys", http.StatusForbidden},
+		{"viewer", "orders:read", http.MethodGet, "/orders", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		name := tt.role + " [" + tt.scopes + "] " + tt.method + " " + tt.path
+		t.Run(name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, tt.path, nil)
+			request.Header.Set("X-Test-Role", tt.role)
+			request.Header.Set("X-Test-Scopes", tt.scopes)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, request)
+			if w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestRequireResponses(t *testing.T) {
+	router := newPolicyRouter(testPolicy)
+
+	// Without an authenticated principal the answer is 401, not 403.
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous status %d, want 401", w.Code)
+	}
+
+	// A 403 names every permission the caller lacks.
+	request := httptest.NewRequest(http.MethodGet, "/orders/o1/payments", nil)
+	request.Header.Set("X-Test-Role", "viewer")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+	var body struct {
+		MissingPermissions []string `json:"missing_permissions"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+	if want := []string{"orders:read", "payments:read"}; w.Code != http.StatusForbidden || !reflect.DeepEqual(body.MissingPermissions, want) {
+		t.Errorf("status %d, missing %v, want 403 and %v", w.Code, body.MissingPermissions, want)
+	}
+}
@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/hsibAD/api-gateway/internal/config"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+const (
+	refreshTokenKeyPrefix  = "refresh_token:"
+	refreshUsedKeyPrefix   = "refresh_token_used:"
+	refreshFamilyKeyPrefix = "refresh_family_revoked:"
+)
+
+// RefreshSession is what a refresh token resolves to. Every token minted by
+// rotating another shares its FamilyID, so a replayed token can revoke the
+// whole chain.
+type RefreshSession struct {
+	UserID          string    `json:"user_id"`
+	FamilyID        string    `json:"family_id"`
+	AuthenticatedAt time.Time `json:"authenticated_at"`
+	ExpiresAt       time.Time `json:"expires_at"`
+}
+
+type RefreshTokenStore struct {
+	redis  *redis.Client
+	config *config.AuthConfig
+}
+
+func NewRefreshTokenStore(client *redis.Client, config *config.AuthConfig) *RefreshTokenStore {
+	return &RefreshTokenStore{
+		redis:  client,
+		config: config,
+	}
+}
+
+// Issue starts a new token family for the user.
+func (s *RefreshTokenStore) Issue(ctx context.Context, userID string) (string, time.Time, error) {
+	familyID, err := randomToken(16)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return s.issue(ctx, userID, familyID, time.Now())
+}
+
+// Rotate consumes a refresh token and returns its session together with a
+// replacement token from the same family. Presenting a token that was already
+// rotated revokes the family and returns ErrRefreshTokenReused.
+func (s *RefreshTokenStore) Rotate(ctx context.Context, token string) (*RefreshSession, string, time.Time, error) {
+	hash := hashToken(token)
+
+	session, err := s.lookup(ctx, hash)
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+
+	ttl := time.Until(session.ExpiresAt)
+	if ttl <= 0 {
+		return nil, "", time.Time{}, ErrInvalidRefreshToken
+	}
+
+	revoked, err := s.redis.Exists(ctx, refreshFamilyKeyPrefix+session.FamilyID).Result()
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+	if revoked > 0 {
+		return nil, "", time.Time{}, ErrInvalidRefreshToken
+	}
+
+	cutoff, err := userRevokedAt(ctx, s.redis, session.UserID)
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+	// AuthenticatedAt is exact, unlike iat, so the cutoff applies to the
+	// nanosecond.
+	if !cutoff.IsZero() && !session.AuthenticatedAt.After(cutoff) {
+		return nil, "", time.Time{}, ErrInvalidRefreshToken
+	}
+
+	// SETNX is the single point that decides which caller gets to rotate.
+	first, err := s.redis.SetNX(ctx, refreshUsedKeyPrefix+hash, 1, ttl).Result()
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+	if !first {
+		if err := s.RevokeFamily(ctx, session.FamilyID); err != nil {
+			return nil, "", time.Time{}, err
+		}
+		return nil, "", time.Time{}, ErrRefreshTokenReused
+	}
+
+	newToken, expiresAt, err := s.issue(ctx, session.UserID, session.FamilyID, session.AuthenticatedAt)
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+	return session, newToken, expiresAt, nil
+}
+
+// Revoke ends the login session the refresh token belongs to. Unknown tokens
+// are ignored so logout stays idempotent.
+func (s *RefreshTokenStore) Revoke(ctx context.Context, token string) error {
+	session, err := s.lookup(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, ErrInvalidRefreshToken) {
+			return nil
+		}
+		return err
+	}
+	return s.RevokeFamily(ctx, session.FamilyID)
+}
+
+// RevokeFamily invalidates every refresh token descended from the same login.
+func (s *RefreshTokenStore) RevokeFamily(ctx context.Context, familyID string) error {
+	return s.redis.Set(ctx, refreshFamilyKeyPrefix+familyID, 1, s.config.RefreshTokenExpiration).Err()
+}
+
+func (s *RefreshTokenStore) lookup(ctx context.Context, hash string) (*RefreshSession, error) {
+	data, err := s.redis.Get(ctx, refreshTokenKeyPrefix+hash).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	var session RefreshSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (s *RefreshTokenStore) issue(ctx context.Context, userID, familyID string, authenticatedAt time.Time) (string, time.Time, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	expiresAt := time.Now().Add(s.config.RefreshTokenExpiration)
+	data, err := json.Marshal(&RefreshSession{
+		UserID:          userID,
+		FamilyID:        familyID,
+		AuthenticatedAt: authenticatedAt,
+		ExpiresAt:       expiresAt,
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	if err := s.redis.Set(ctx, refreshTokenKeyPrefix+hashToken(token), data, s.config.RefreshTokenExpiration).Err(); err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// hashToken keys Redis by a digest so a dump of the store does not leak
+// usable refresh tokens.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/hsibAD/api-gateway/internal/config"
+)
+
+func newTestRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func newTestRefreshTokenStore(t *testing.T) *RefreshTokenStore {
+	t.Helper()
+	return NewRefreshTokenStore(newTestRedis(t), &config.AuthConfig{RefreshTokenExpiration: time.Hour})
+}
+
+func TestRefreshTokenRotate(t *testing.T) {
+	ctx := context.Background()
+	store := newTestRefreshTokenStore(t)
+
+	token, _, err := store.Issue(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	session, next, expiresAt, err := store.Rotate(ctx, token)
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if session.UserID != "user-1" {
+		t.Errorf("session user = %q, want user-1", session.UserID)
+	}
+	if next == "" || next == token {
+		t.Errorf("Rotate returned %q, want a new token", next)
+	}
+	if time.Until(expiresAt) <= 0 {
+		t.Errorf("new token expires at %v, want in the future", expiresAt)
+	}
+
+	nextSession, _, _, err := store.Rotate(ctx, next)
+	if err != nil {
+		t.Fatalf("Rotate of the replacement: %v", err)
+	}
+	if nextSession.FamilyID != session.FamilyID {
+		t.Errorf("family changed on rotation: %q, want %q", nextSession.FamilyID, session.FamilyID)
+	}
+	if !nextSession.AuthenticatedAt.Equal(session.AuthenticatedAt) {
+		t.Errorf("authenticated_at changed on rotation")
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	ctx := context.Background()
+	store := newTestRefreshTokenStore(t)
+
+	token, _, err := store.Issue(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	_, next, _, err := store.Rotate(ctx, token)
+	if err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+
+	// Replaying the rotated token is taken as theft.
+	if _, _, _, err := store.Rotate(ctx, token); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("replayed Rotate error = %v, want ErrRefreshTokenReused", err)
+	}
+	// The legitimate holder's newer token dies with the family.
+	if _, _, _, err := store.Rotate(ctx, next); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("Rotate after reuse error = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestRefreshTokenRevoke(t *testing.T) {
+	ctx := context.Background()
+	store := newTestRefreshTokenStore(t)
+
+	token, _, err := store.Issue(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	other, _, err := store.Issue(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	if err := store.Revoke(ctx, token); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, _, _, err := store.Rotate(ctx, token); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Rotate of a revoked token error = %v, want ErrInvalidRefreshToken", err)
+	}
+	// Other logins of the same user are separate families.
+	if _, _, _, err := store.Rotate(ctx, other); err != nil {
+		t.Errorf("Rotate of another family: %v", err)
+	}
+	// Logging out twice is harmless.
+	if err := store.Revoke(ctx, "unknown"); err != nil {
+		t.Errorf("Revoke of an unknown token: %v", err)
+	}
+}
+
+func TestRefreshTokenUserRevocation(t *testing.T) {
+	ctx := context.Background()
+	client := newTestRedis(t)
+	cfg := &config.AuthConfig{RefreshTokenExpiration: time.Hour, DenylistCacheSize: 10, DenylistCacheTTL: time.Second}
+	store := NewRefreshTokenStore(client, cfg)
+	denylist := NewDenylist(client, cfg)
+
+	token, _, err := store.Issue(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	// Sessions carry their exact login time, so even one from the same
+	// second as the revocation is cut off.
+	if err := denylist.RevokeUser(ctx, "user-1"); err != nil {
+		t.Fatalf("RevokeUser: %v", err)
+	}
+	if _, _, _, err := store.Rotate(ctx, token); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Rotate after RevokeUser error = %v, want ErrInvalidRefreshToken", err)
+	}
+
+	// Logging in again right away starts a session that is not.
+	token, _, err = store.Issue(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if _, _, _, err := store.Rotate(ctx, token); err != nil {
+		t.Errorf("Rotate of a session started after RevokeUser: %v", err)
+	}
+}
+
+func TestRefreshTokenUnknown(t *testing.T) {
+	store := newTestRefreshTokenStore(t)
+	if _, _, _, err := store.Rotate(context.Background(), "not-a-token"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Rotate error = %v, want ErrInvalidRefreshToken", err)
+	}
+}
@@ -1,87 +1,319 @@
 package config
 
 import (
-	"os"
-	"strconv"
 	"time"
 )
 
 type Config struct {
-	Server        ServerConfig
-	Services      ServicesConfig
-	Auth          AuthConfig
-	RateLimiting  RateLimitConfig
-	Redis         RedisConfig
+	// Environment is "development" or "production". Development relaxes
+	// checks meant to keep insecure defaults out of production.
+	Environment  string            `yaml:"environment"`
+	Server       ServerConfig      `yaml:"server"`
+	Services     ServicesConfig    `yaml:"services"`
+	Auth         AuthConfig        `yaml:"auth"`
+	RateLimiting RateLimitConfig   `yaml:"rate_limiting"`
+	Redis        RedisConfig       `yaml:"redis"`
+	Users        UsersConfig       `yaml:"users"`
+	RBAC         RBACConfig        `yaml:"rbac"`
+	Quotas       QuotaConfig       `yaml:"quotas"`
+	Concurrency  ConcurrencyConfig `yaml:"concurrency"`
+	IPFilter     IPFilterConfig    `yaml:"ip_filter"`
+	Tracing      TracingConfig     `yaml:"tracing"`
 }
 
 type ServerConfig struct {
-	Port            string
-	ReadTimeout     time.Duration
-	WriteTimeout    time.Duration
-	ShutdownTimeout time.Duration
+	Port            string        `yaml:"port"`
+	ReadTimeout     time.Duration `yaml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// TrustedProxies are the CIDR ranges whose forwarding headers and
+	// PROXY protocol headers are believed.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	ProxyProtocol  bool     `yaml:"proxy_protocol"`
+	// ConfigWatchInterval is how often the config files are checked for
+	// changes; 0 disables watching (SIGHUP still reloads).
+	ConfigWatchInterval time.Duration `yaml:"config_watch_interval"`
 }
 
 type ServicesConfig struct {
-	OrderServiceURL   string
-	PaymentServiceURL string
+	OrderServiceURL   string `yaml:"order_service_url"`
+	PaymentServiceURL string `yaml:"payment_service_url"`
 }
 
 type AuthConfig struct {
-	JWTSecret        string
-	TokenExpiration  time.Duration
+	JWTSecret string `yaml:"jwt_secret"`
+	// SigningKeys is ordered: the first key signs new tokens, the rest are
+	// only accepted for verification. KeySetFile, when set, replaces it and
+	// is re-read on every key reload.
+	SigningKeys            []SigningKeyConfig `yaml:"signing_keys"`
+	KeySetFile             string             `yaml:"keyset_file"`
+	TokenExpiration        time.Duration      `yaml:"token_expiration"`
+	RefreshTokenExpiration time.Duration      `yaml:"refresh_token_expiration"`
+	DenylistCacheSize      int                `yaml:"denylist_cache_size"`
+	DenylistCacheTTL       time.Duration      `yaml:"denylist_cache_ttl"`
+	OIDC                   OIDCConfig         `yaml:"oidc"`
+}
+
+// OIDCConfig enables accepting tokens from an external OpenID Connect
+// provider alongside the gateway's own. It is disabled while Issuer is empty.
+type OIDCConfig struct {
+	Issuer   string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+	// UserIDClaim and RoleClaim name the claims mapped onto the user_id and
+	// role context keys; dotted paths reach into nested objects.
+	UserIDClaim     string        `yaml:"user_id_claim"`
+	RoleClaim       string        `yaml:"role_claim"`
+	DefaultRole     string        `yaml:"default_role"`
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+	ClockSkew       time.Duration `yaml:"clock_skew"`
+}
+
+// SigningKeyConfig describes one JWT key. KeyFile holds a PEM private or
+// public key for asymmetric algorithms, or the raw secret for HS256; an HS256
+// key without a KeyFile falls back to JWTSecret.
+type SigningKeyConfig struct {
+	ID        string `json:"kid" yaml:"kid"`
+	Algorithm string `json:"alg" yaml:"alg"`
+	KeyFile   string `json:"key_file" yaml:"key_file"`
+}
+
+// RBACConfig maps roles to permissions such as "orders:read". PolicyFile,
+// when set, is a JSON document {"roles": {...}} that replaces Roles.
+type RBACConfig struct {
+	PolicyFile string              `yaml:"policy_file"`
+	Roles      map[string][]string `yaml:"roles"`
 }
 
 type RateLimitConfig struct {
-	RequestsPerMinute int
-	BurstSize        int
+	RequestsPerMinute int `yaml:"requests_per_minute"`
+	BurstSize         int `yaml:"burst_size"`
+	// Algorithm is "token_bucket" (honours BurstSize) or "sliding_window".
+	Algorithm string `yaml:"algorithm"`
+	// Policies is an ordered table; the first one matching a request after
+	// authentication applies. PolicyFile, when set, replaces it.
+	Policies   []RateLimitPolicy `yaml:"policies"`
+	PolicyFile string            `yaml:"policy_file"`
+	// FailureMode decides what happens while Redis is unreachable:
+	// "fallback" limits with a per-instance in-memory bucket, "open" lets
+	// everything through and "closed" rejects with 503.
+	FailureMode      string        `yaml:"failure_mode"`
+	RedisTimeout     time.Duration `yaml:"redis_timeout"`
+	BreakerThreshold int           `yaml:"breaker_threshold"`
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown"`
+}
+
+// RateLimitPolicy limits requests matching Methods, Route and Roles (empty
+// means any). Route is a gin route template such as "/api/v1/orders/:id", or
+// a prefix ending in "*". Key picks what is counted together: "ip", "user",
+// "api_key", "route" or "header:<Name>", combined with "+".
+type RateLimitPolicy struct {
+	Name              string   `json:"name" yaml:"name"`
+	Methods           []string `json:"methods" yaml:"methods"`
+	Route             string   `json:"route" yaml:"route"`
+	Roles             []string `json:"roles" yaml:"roles"`
+	Key               string   `json:"key" yaml:"key"`
+	RequestsPerMinute int      `json:"requests_per_minute" yaml:"requests_per_minute"`
+	BurstSize         int      `json:"burst_size" yaml:"burst_size"`
+}
+
+// QuotaConfig defines the named plans subjects can be assigned to.
+// Subjects without an assignment are on DefaultPlan.
+type QuotaConfig struct {
+	DefaultPlan string               `yaml:"default_plan"`
+	Plans       map[string]QuotaPlan `yaml:"plans"`
+	PlanFile    string               `yaml:"plan_file"`
+}
+
+// QuotaPlan limits are counted per UTC day and month; 0 means unlimited.
+type QuotaPlan struct {
+	RequestsPerDay   int64 `json:"requests_per_day" yaml:"requests_per_day"`
+	RequestsPerMonth int64 `json:"requests_per_month" yaml:"requests_per_month"`
+}
+
+// ConcurrencyConfig caps the requests in flight per route group and per
+// backend. Backend limits start at their configured value and, in the aimd
+// and gradient modes, move between MinLimit and that value with latency.
+// CriticalReserve is the share of each limit only CriticalRoutes
+// ("METHOD /route/template") may use.
+type ConcurrencyConfig struct {
+	Mode            string         `yaml:"mode"`
+	Groups          map[string]int `yaml:"groups"`
+	Backends        map[string]int `yaml:"backends"`
+	MinLimit        int            `yaml:"min_limit"`
+	TargetLatency   time.Duration  `yaml:"target_latency"`
+	CriticalReserve float64        `yaml:"critical_reserve"`
+	CriticalRoutes  []string       `yaml:"critical_routes"`
+	RetryAfter      time.Duration  `yaml:"retry_after"`
+}
+
+// IPFilterConfig holds CIDR ranges that are always allowed (exempt from
+// rate limiting) or denied, on top of those managed through the admin API.
+type IPFilterConfig struct {
+	Allow           []string      `yaml:"allow"`
+	Deny            []string      `yaml:"deny"`
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+}
+
+// TracingConfig selects where spans are sent. Exporter is "none", "otlp"
+// (OTLP over gRPC to Endpoint) or "stdout", which writes spans as JSON to
+// File, or to standard output when File is empty.
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter"`
+	Endpoint    string  `yaml:"endpoint"`
+	Insecure    bool    `yaml:"insecure"`
+	File        string  `yaml:"file"`
+	ServiceName string  `yaml:"service_name"`
+	SampleRatio float64 `yaml:"sample_ratio"`
 }
 
 type RedisConfig struct {
-	URL      string
-	Password string
-	DB       int
+	URL      string `yaml:"url"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+}
+
+type UsersConfig struct {
+	// Store selects the user store backend: "redis" or "memory".
+	Store string `yaml:"store"`
 }
 
-func Load() *Config {
+const (
+	EnvironmentDevelopment = "development"
+	EnvironmentProduction  = "production"
+
+	// defaultJWTSecret is only accepted in development.
+	defaultJWTSecret = "your-secret-key"
+)
+
+// Default returns the built-in configuration that files and environment
+// variables are layered on.
+func Default() *Config {
 	return &Config{
+		Environment: EnvironmentProduction,
 		Server: ServerConfig{
-			Port:            getEnv("PORT", "8080"),
-			ReadTimeout:     time.Second * 5,
-			WriteTimeout:    time.Second * 10,
-			ShutdownTimeout: time.Second * 30,
+			Port:                "8080",
+			ReadTimeout:         time.Second * 5,
+			WriteTimeout:        time.Second * 10,
+			ShutdownTimeout:     time.Second * 30,
+			ConfigWatchInterval: time.Second * 5,
 		},
 		Services: ServicesConfig{
-			OrderServiceURL:   getEnv("ORDER_SERVICE_URL", "localhost:50051"),
-			PaymentServiceURL: getEnv("PAYMENT_SERVICE_URL", "localhost:50052"),
+			OrderServiceURL:   "localhost:50051",
+			PaymentServiceURL: "localhost:50052",
 		},
 		Auth: AuthConfig{
-			JWTSecret:       getEnv("JWT_SECRET", "your-secret-key"),
-			TokenExpiration: time.Hour * 24,
+			JWTSecret: defaultJWTSecret,
+			SigningKeys: []SigningKeyConfig{
+				{Algorithm: "HS256"},
+			},
+			TokenExpiration:        time.Minute * 15,
+			RefreshTokenExpiration: time.Hour * 24 * 7,
+			DenylistCacheSize:      10000,
+			DenylistCacheTTL:       time.Second * 5,
+			OIDC: OIDCConfig{
+				UserIDClaim:     "sub",
+				RoleClaim:       "role",
+				DefaultRole:     "user",
+				RefreshInterval: time.Minute * 15,
+				ClockSkew:       time.Second * 30,
+			},
 		},
 		RateLimiting: RateLimitConfig{
-			RequestsPerMinute: getEnvAsInt("RATE_LIMIT", 60),
-			BurstSize:        getEnvAsInt("RATE_LIMIT_BURST", 10),
+			// Shared by everyone behind one address before authentication,
+			// so it is loose; the per-user policies below do the limiting.
+			RequestsPerMinute: 600,
+			BurstSize:         100,
+			Algorithm:         "token_bucket",
+			FailureMode:       "fallback",
+			RedisTimeout:      time.Millisecond * 100,
+			BreakerThreshold:  5,
+			BreakerCooldown:   time.Second * 10,
+			Policies: []RateLimitPolicy{
+				{
+					Name:              "payment-card",
+					Methods:           []string{"POST"},
+					Route:             "/api/v1/payments/credit-card",
+					Key:               "user",
+					RequestsPerMinute: 10,
+					BurstSize:         3,
+				},
+				{
+					Name:              "payment-writes",
+					Methods:           []string{"POST", "PUT"},
+					Route:             "/api/v1/payments*",
+					Key:               "user",
+					RequestsPerMinute: 30,
+					BurstSize:         5,
+				},
+				{
+					Name:              "auth",
+					Route:             "/api/v1/auth/*",
+					Key:               "ip",
+					RequestsPerMinute: 20,
+					BurstSize:         5,
+				},
+				{
+					Name:              "default",
+					Route:             "*",
+					Key:               "user",
+					RequestsPerMinute: 120,
+					BurstSize:         20,
+				},
+			},
 		},
 		Redis: RedisConfig{
-			URL:      getEnv("REDIS_URL", "localhost:6379"),
-			Password: getEnv("REDIS_PASSWORD", ""),
-			DB:       getEnvAsInt("REDIS_DB", 0),
+			URL: "localhost:6379",
+			DB:  0,
+		},
+		Users: UsersConfig{
+			Store: "redis",
+		},
+		Quotas: QuotaConfig{
+			DefaultPlan: "free",
+			Plans: map[string]QuotaPlan{
+				"free":       {RequestsPerDay: 1000, RequestsPerMonth: 20000},
+				"pro":        {RequestsPerDay: 50000, RequestsPerMonth: 1000000},
+				"enterprise": {RequestsPerDay: 0, RequestsPerMonth: 0},
+			},
+		},
+		Concurrency: ConcurrencyConfig{
+			Mode: "aimd",
+			Groups: map[string]int{
+				"orders":    200,
+				"addresses": 100,
+				"payments":  200,
+			},
+			Backends: map[string]int{
+				"order-service":   256,
+				"payment-service": 256,
+			},
+			MinLimit:        10,
+			TargetLatency:   time.Millisecond * 500,
+			CriticalReserve: 0.2,
+			CriticalRoutes: []string{
+				"POST /api/v1/payments/metamask/confirm",
+			},
+			RetryAfter: time.Second * 2,
+		},
+		IPFilter: IPFilterConfig{
+			RefreshInterval: time.Second * 10,
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			Endpoint:    "localhost:4317",
+			ServiceName: "api-gateway",
+			SampleRatio: 1,
+		},
+		RBAC: RBACConfig{
+			Roles: map[string][]string{
+				"user": {
+					"orders:read", "orders:write",
+					"addresses:read", "addresses:write",
+					"payments:read", "payments:write",
+					"quota:read",
+				},
+				"admin": {"*"},
+			},
 		},
 	}
 }
-
-func getEnv(key, defaultValue string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
-	}
-	return defaultValue
-}
-
-func getEnvAsInt(key string, defaultValue int) int {
-	if value, exists := os.LookupEnv(key); exists {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
-		}
-	}
-	return defaultValue
-} 
\ No newline at end of file
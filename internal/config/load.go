@@ -0,0 +1,256 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Load builds the configuration from the defaults, the YAML or TOML file at
+// path (if any) and environment variables, each overriding the one before,
+// then validates it. In the file, lists replace the defaults while maps
+// such as rbac.roles are merged into them.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		if err := decodeFile(path, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	env := &envReader{}
+	env.apply(cfg)
+	if err := errors.Join(env.errs...); err != nil {
+		return nil, fmt.Errorf("invalid environment: %w", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return cfg, nil
+}
+
+// decodeFile reads a YAML or TOML file onto cfg. TOML is converted to YAML
+// first so both formats share the same keys and duration syntax ("15m").
+// Unknown keys are rejected to catch typos.
+func decodeFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+	case ".toml":
+		var doc map[string]interface{}
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+		if data, err = yaml.Marshal(doc); err != nil {
+			return fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("config file %s must end in .yaml, .yml or .toml", path)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && err != io.EOF {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// envReader applies environment overrides, collecting malformed values
+// instead of silently keeping the previous setting.
+type envReader struct {
+	errs []error
+}
+
+func (e *envReader) apply(cfg *Config) {
+	e.string("GATEWAY_ENV", &cfg.Environment)
+
+	e.string("PORT", &cfg.Server.Port)
+	e.duration("READ_TIMEOUT", &cfg.Server.ReadTimeout)
+	e.duration("WRITE_TIMEOUT", &cfg.Server.WriteTimeout)
+	e.duration("SHUTDOWN_TIMEOUT", &cfg.Server.ShutdownTimeout)
+	e.list("TRUSTED_PROXIES", &cfg.Server.TrustedProxies)
+	e.bool("PROXY_PROTOCOL", &cfg.Server.ProxyProtocol)
+	e.duration("CONFIG_WATCH_INTERVAL", &cfg.Server.ConfigWatchInterval)
+
+	e.string("ORDER_SERVICE_URL", &cfg.Services.OrderServiceURL)
+	e.string("PAYMENT_SERVICE_URL", &cfg.Services.PaymentServiceURL)
+
+	e.string("JWT_SECRET", &cfg.Auth.JWTSecret)
+	if len(cfg.Auth.SigningKeys) == 0 {
+		cfg.Auth.SigningKeys = []SigningKeyConfig{{Algorithm: "HS256"}}
+	}
+	e.string("JWT_KEY_ID", &cfg.Auth.SigningKeys[0].ID)
+	e.string("JWT_ALGORITHM", &cfg.Auth.SigningKeys[0].Algorithm)
+	e.string("JWT_PRIVATE_KEY_FILE", &cfg.Auth.SigningKeys[0].KeyFile)
+	e.string("JWT_KEYSET_FILE", &cfg.Auth.KeySetFile)
+	e.duration("JWT_EXPIRATION", &cfg.Auth.TokenExpiration)
+	e.duration("REFRESH_TOKEN_EXPIRATION", &cfg.Auth.RefreshTokenExpiration)
+	e.int("DENYLIST_CACHE_SIZE", &cfg.Auth.DenylistCacheSize)
+	e.string("OIDC_ISSUER", &cfg.Auth.OIDC.Issuer)
+	e.string("OIDC_AUDIENCE", &cfg.Auth.OIDC.Audience)
+	e.string("OIDC_USER_ID_CLAIM", &cfg.Auth.OIDC.UserIDClaim)
+	e.string("OIDC_ROLE_CLAIM", &cfg.Auth.OIDC.RoleClaim)
+	e.string("OIDC_DEFAULT_ROLE", &cfg.Auth.OIDC.DefaultRole)
+
+	e.int("RATE_LIMIT", &cfg.RateLimiting.RequestsPerMinute)
+	e.int("RATE_LIMIT_BURST", &cfg.RateLimiting.BurstSize)
+	e.string("RATE_LIMIT_ALGORITHM", &cfg.RateLimiting.Algorithm)
+	e.string("RATE_LIMIT_POLICY_FILE", &cfg.RateLimiting.PolicyFile)
+	e.string("RATE_LIMIT_FAILURE_MODE", &cfg.RateLimiting.FailureMode)
+
+	e.string("REDIS_URL", &cfg.Redis.URL)
+	e.string("REDIS_PASSWORD", &cfg.Redis.Password)
+	e.int("REDIS_DB", &cfg.Redis.DB)
+
+	e.string("USER_STORE", &cfg.Users.Store)
+
+	e.string("QUOTA_DEFAULT_PLAN", &cfg.Quotas.DefaultPlan)
+	e.string("QUOTA_PLAN_FILE", &cfg.Quotas.PlanFile)
+
+	e.string("CONCURRENCY_MODE", &cfg.Concurrency.Mode)
+	e.mapInt("CONCURRENCY_ORDERS", &cfg.Concurrency.Groups, "orders")
+	e.mapInt("CONCURRENCY_ADDRESSES", &cfg.Concurrency.Groups, "addresses")
+	e.mapInt("CONCURRENCY_PAYMENTS", &cfg.Concurrency.Groups, "payments")
+	e.mapInt("CONCURRENCY_ORDER_SERVICE", &cfg.Concurrency.Backends, "order-service")
+	e.mapInt("CONCURRENCY_PAYMENT_SERVICE", &cfg.Concurrency.Backends, "payment-service")
+	e.int("CONCURRENCY_MIN_LIMIT", &cfg.Concurrency.MinLimit)
+	if ms, ok := e.lookupInt("CONCURRENCY_TARGET_LATENCY_MS"); ok {
+		cfg.Concurrency.TargetLatency = time.Duration(ms) * time.Millisecond
+	}
+
+	e.list("IP_ALLOWLIST", &cfg.IPFilter.Allow)
+	e.list("IP_DENYLIST", &cfg.IPFilter.Deny)
+
+	e.string("RBAC_POLICY_FILE", &cfg.RBAC.PolicyFile)
+
+	e.string("TRACING_EXPORTER", &cfg.Tracing.Exporter)
+	e.string("OTEL_EXPORTER_OTLP_ENDPOINT", &cfg.Tracing.Endpoint)
+	e.bool("OTEL_EXPORTER_OTLP_INSECURE", &cfg.Tracing.Insecure)
+	e.string("TRACING_FILE", &cfg.Tracing.File)
+	e.string("OTEL_SERVICE_NAME", &cfg.Tracing.ServiceName)
+	e.float("TRACING_SAMPLE_RATIO", &cfg.Tracing.SampleRatio)
+}
+
+func (e *envReader) string(key string, dst *string) {
+	if value, exists := os.LookupEnv(key); exists {
+		*dst = value
+	}
+}
+
+func (e *envReader) int(key string, dst *int) {
+	if value, ok := e.lookupInt(key); ok {
+		*dst = int(value)
+	}
+}
+
+func (e *envReader) mapInt(key string, dst *map[string]int, name string) {
+	if value, ok := e.lookupInt(key); ok {
+		if *dst == nil {
+			*dst = make(map[string]int)
+		}
+		(*dst)[name] = int(value)
+	}
+}
+
+func (e *envReader) lookupInt(key string) (int64, bool) {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return 0, false
+	}
+	intValue, err := strconv.ParseInt(strings.TrimSpace(value), 10, 0)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: %q is not an integer", key, value))
+		return 0, false
+	}
+	return intValue, true
+}
+
+func (e *envReader) bool(key string, dst *bool) {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return
+	}
+	boolValue, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: %q is not a boolean", key, value))
+		return
+	}
+	*dst = boolValue
+}
+
+func (e *envReader) float(key string, dst *float64) {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return
+	}
+	floatValue, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: %q is not a number", key, value))
+		return
+	}
+	*dst = floatValue
+}
+
+func (e *envReader) duration(key string, dst *time.Duration) {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return
+	}
+	duration, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: %q is not a duration such as 30s or 15m", key, value))
+		return
+	}
+	*dst = duration
+}
+
+// list splits a comma-separated variable, ignoring empty entries.
+func (e *envReader) list(key string, dst *[]string) {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return
+	}
+	var values []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	*dst = values
+}
+
+const redacted = "[REDACTED]"
+
+// Redacted returns a copy of the configuration with secrets masked, safe to
+// log.
+func (c *Config) Redacted() *Config {
+	r := *c
+	if r.Auth.JWTSecret != "" {
+		r.Auth.JWTSecret = redacted
+	}
+	if r.Redis.Password != "" {
+		r.Redis.Password = redacted
+	}
+	return &r
+}
+
+// YAML renders the configuration in the config file format.
+func (c *Config) YAML() ([]byte, error) {
+	return yaml.Marshal(c)
+}
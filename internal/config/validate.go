@@ -0,0 +1,169 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// minJWTSecretLength is the shortest HMAC secret accepted outside
+// development: 256 bits, as RFC 7518 requires for HS256.
+const minJWTSecretLength = 32
+
+// Validate reports every problem with the configuration at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	oneOf := func(value string, allowed ...string) bool {
+		for _, a := range allowed {
+			if value == a {
+				return true
+			}
+		}
+		return false
+	}
+
+	check(oneOf(c.Environment, EnvironmentDevelopment, EnvironmentProduction),
+		"environment must be %q or %q, got %q", EnvironmentDevelopment, EnvironmentProduction, c.Environment)
+	dev := c.Environment == EnvironmentDevelopment
+
+	// Server
+	port, err := strconv.Atoi(c.Server.Port)
+	check(err == nil && port > 0 && port < 65536, "server.port must be a TCP port, got %q", c.Server.Port)
+	check(c.Server.ReadTimeout > 0, "server.read_timeout must be positive")
+	check(c.Server.WriteTimeout > 0, "server.write_timeout must be positive")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	check(c.Server.ConfigWatchInterval >= 0, "server.config_watch_interval must not be negative")
+	for _, cidr := range c.Server.TrustedProxies {
+		check(validCIDR(cidr), "server.trusted_proxies: %q is not an IP address or CIDR range", cidr)
+	}
+	check(!c.Server.ProxyProtocol || len(c.Server.TrustedProxies) > 0,
+		"server.proxy_protocol needs server.trusted_proxies to accept headers from")
+
+	// Services
+	check(c.Services.OrderServiceURL != "", "services.order_service_url is required")
+	check(c.Services.PaymentServiceURL != "", "services.payment_service_url is required")
+
+	// Auth
+	keys := c.Auth.SigningKeys
+	if c.Auth.KeySetFile != "" {
+		keys, err = readKeySet(c.Auth.KeySetFile)
+		check(err == nil, "auth.keyset_file: %v", err)
+	} else {
+		check(len(keys) > 0, "auth.signing_keys needs at least one key")
+	}
+	usesSecret := false
+	for _, key := range keys {
+		usesSecret = usesSecret || usesJWTSecret(key)
+	}
+	switch {
+	case !usesSecret:
+	case c.Auth.JWTSecret == "":
+		errs = append(errs, errors.New("auth.jwt_secret is required for HMAC keys without a key_file"))
+	case dev:
+	case c.Auth.JWTSecret == defaultJWTSecret:
+		errs = append(errs, errors.New("auth.jwt_secret is the built-in default; set JWT_SECRET or run with GATEWAY_ENV=development"))
+	case len(c.Auth.JWTSecret) < minJWTSecretLength:
+		errs = append(errs, fmt.Errorf("auth.jwt_secret must be at least %d bytes", minJWTSecretLength))
+	}
+	check(c.Auth.TokenExpiration > 0, "auth.token_expiration must be positive")
+	check(c.Auth.RefreshTokenExpiration > c.Auth.TokenExpiration,
+		"auth.refresh_token_expiration must be longer than auth.token_expiration")
+	check(c.Auth.DenylistCacheSize >= 0, "auth.denylist_cache_size must not be negative")
+	check(c.Auth.DenylistCacheTTL >= 0, "auth.denylist_cache_ttl must not be negative")
+	check(c.Auth.OIDC.Issuer == "" || c.Auth.OIDC.Audience != "", "auth.oidc.audience is required when auth.oidc.issuer is set")
+	check(c.Auth.OIDC.Issuer == "" || c.Auth.OIDC.RefreshInterval > 0, "auth.oidc.refresh_interval must be positive")
+	check(c.Auth.OIDC.ClockSkew >= 0, "auth.oidc.clock_skew must not be negative")
+
+	// Rate limiting
+	rl := c.RateLimiting
+	check(rl.RequestsPerMinute > 0, "rate_limiting.requests_per_minute must be positive")
+	check(rl.BurstSize >= 0, "rate_limiting.burst_size must not be negative")
+	check(oneOf(rl.Algorithm, "token_bucket", "sliding_window"), "rate_limiting.algorithm %q is unknown", rl.Algorithm)
+	check(oneOf(rl.FailureMode, "fallback", "open", "closed"), "rate_limiting.failure_mode %q is unknown", rl.FailureMode)
+	check(rl.RedisTimeout > 0, "rate_limiting.redis_timeout must be positive")
+	check(rl.BreakerThreshold > 0, "rate_limiting.breaker_threshold must be positive")
+	check(rl.BreakerCooldown >= 0, "rate_limiting.breaker_cooldown must not be negative")
+	for _, policy := range rl.Policies {
+		check(policy.Name != "", "rate_limiting.policies: every policy needs a name")
+		check(policy.RequestsPerMinute > 0, "rate_limiting.policies: %q needs a positive requests_per_minute", policy.Name)
+		check(policy.BurstSize >= 0, "rate_limiting.policies: %q has a negative burst_size", policy.Name)
+	}
+
+	check(c.Redis.DB >= 0, "redis.db must not be negative")
+	check(oneOf(c.Users.Store, "redis", "memory"), "users.store %q is unknown", c.Users.Store)
+
+	// Quotas
+	if c.Quotas.PlanFile == "" {
+		_, ok := c.Quotas.Plans[c.Quotas.DefaultPlan]
+		check(ok, "quotas.default_plan %q is not defined", c.Quotas.DefaultPlan)
+	}
+	for name, plan := range c.Quotas.Plans {
+		check(plan.RequestsPerDay >= 0 && plan.RequestsPerMonth >= 0, "quotas.plans.%s: limits must not be negative", name)
+	}
+
+	// Concurrency
+	cc := c.Concurrency
+	check(oneOf(cc.Mode, "static", "aimd", "gradient"), "concurrency.mode %q is unknown", cc.Mode)
+	check(cc.MinLimit > 0, "concurrency.min_limit must be positive")
+	check(cc.TargetLatency > 0, "concurrency.target_latency must be positive")
+	check(cc.CriticalReserve >= 0 && cc.CriticalReserve < 1, "concurrency.critical_reserve must be in [0, 1)")
+	check(cc.RetryAfter >= 0, "concurrency.retry_after must not be negative")
+	for name, limit := range cc.Groups {
+		check(limit > 0, "concurrency.groups.%s must be positive", name)
+	}
+	for name, limit := range cc.Backends {
+		check(limit >= cc.MinLimit, "concurrency.backends.%s must be at least concurrency.min_limit", name)
+	}
+
+	// IP filter
+	for _, cidr := range append(append([]string(nil), c.IPFilter.Allow...), c.IPFilter.Deny...) {
+		check(validCIDR(cidr), "ip_filter: %q is not an IP address or CIDR range", cidr)
+	}
+	check(c.IPFilter.RefreshInterval > 0, "ip_filter.refresh_interval must be positive")
+
+	// Tracing
+	tc := c.Tracing
+	check(oneOf(tc.Exporter, "none", "otlp", "stdout"), "tracing.exporter %q is unknown", tc.Exporter)
+	check(tc.Exporter != "otlp" || tc.Endpoint != "", "tracing.endpoint is required for the otlp exporter")
+	check(tc.ServiceName != "", "tracing.service_name is required")
+	check(tc.SampleRatio >= 0 && tc.SampleRatio <= 1, "tracing.sample_ratio must be in [0, 1]")
+
+	return errors.Join(errs...)
+}
+
+// usesJWTSecret reports whether key is signed with auth.jwt_secret: an HMAC
+// key, HS256 unless alg says otherwise, without a key_file of its own.
+func usesJWTSecret(key SigningKeyConfig) bool {
+	return (key.Algorithm == "" || strings.HasPrefix(key.Algorithm, "HS")) && key.KeyFile == ""
+}
+
+// readKeySet reads the JSON key list that auth loads from
+// auth.keyset_file.
+func readKeySet(path string) ([]SigningKeyConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []SigningKeyConfig
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return keys, nil
+}
+
+func validCIDR(cidr string) bool {
+	if _, err := netip.ParsePrefix(cidr); err == nil {
+		return true
+	}
+	_, err := netip.ParseAddr(cidr)
+	return err == nil
+}
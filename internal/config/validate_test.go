@@ -0,0 +1,212 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func validConfig() *Config {
+	cfg := Default()
+	cfg.Auth.JWTSecret = strings.Repeat("s", minJWTSecretLength)
+	return cfg
+}
+
+func TestValidateDefaults(t *testing.T) {
+	if err := validConfig().Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	dev := Default()
+	dev.Environment = EnvironmentDevelopment
+	if err := dev.Validate(); err != nil {
+		t.Errorf("Validate in development with the default secret: %v", err)
+	}
+	if err := Default().Validate(); err == nil || !strings.Contains(err.Error(), "auth.jwt_secret is the built-in default") {
+		t.Errorf("Validate in production with the default secret error = %v, want the default secret rejected", err)
+	}
+}
+
+func TestValidateJWTSecret(t *testing.T) {
+	keySet := func(t *testing.T, content string) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "keys.json")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*testing.T, *Config)
+		want   string // "" for valid
+	}{
+		{"key without alg, default secret", func(t *testing.T, c *Config) {
+			c.Auth.JWTSecret = defaultJWTSecret
+			c.Auth.SigningKeys = []SigningKeyConfig{{ID: "k1"}}
+		}, "built-in default"},
+		{"key without alg, short secret", func(t *testing.T, c *Config) {
+			c.Auth.JWTSecret = "short"
+			c.Auth.SigningKeys = []SigningKeyConfig{{ID: "k1"}}
+		}, "at least 32 bytes"},
+		{"HMAC key file, default secret", func(t *testing.T, c *Config) {
+			c.Auth.JWTSecret = defaultJWTSecret
+			c.Auth.SigningKeys = []SigningKeyConfig{{ID: "k1", KeyFile: "/etc/gateway/hmac.key"}}
+		}, ""},
+		{"asymmetric keys, no secret", func(t *testing.T, c *Config) {
+			c.Auth.JWTSecret = ""
+			c.Auth.SigningKeys = []SigningKeyConfig{{ID: "k1", Algorithm: "ES256", KeyFile: "/etc/gateway/ec.pem"}}
+		}, ""},
+		{"key set entry without key_file, default secret", func(t *testing.T, c *Config) {
+			c.Auth.JWTSecret = defaultJWTSecret
+			c.Auth.KeySetFile = keySet(t, `[{"kid": "new", "alg": "ES256", "key_file": "/etc/gateway/ec.pem"}, {"kid": "old"}]`)
+		}, "built-in default"},
+		{"key set entry without key_file, no secret", func(t *testing.T, c *Config) {
+			c.Auth.JWTSecret = ""
+			c.Auth.KeySetFile = keySet(t, `[{"kid": "old", "alg": "HS256"}]`)
+		}, "auth.jwt_secret is required"},
+		{"asymmetric key set, default secret", func(t *testing.T, c *Config) {
+			c.Auth.JWTSecret = defaultJWTSecret
+			c.Auth.KeySetFile = keySet(t, `[{"kid": "new", "alg": "ES256", "key_file": "/etc/gateway/ec.pem"}]`)
+		}, ""},
+		{"unreadable key set", func(t *testing.T, c *Config) {
+			c.Auth.KeySetFile = filepath.Join(t.TempDir(), "missing.json")
+		}, "auth.keyset_file"},
+		{"malformed key set", func(t *testing.T, c *Config) {
+			c.Auth.KeySetFile = keySet(t, `{"kid": "new"}`)
+		}, "auth.keyset_file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.modify(t, cfg)
+			err := cfg.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate error = %v, want one mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   string
+	}{
+		{"unknown environment", func(c *Config) { c.Environment = "staging" }, "environment must be"},
+		{"port", func(c *Config) { c.Server.Port = "http" }, "server.port"},
+		{"trusted proxy", func(c *Config) { c.Server.TrustedProxies = []string{"10.0.0.0/33"} }, "server.trusted_proxies"},
+		{"proxy protocol without trusted proxies", func(c *Config) {
+			c.Server.ProxyProtocol = true
+			c.Server.TrustedProxies = nil
+		}, "server.proxy_protocol"},
+		{"short secret", func(c *Config) { c.Auth.JWTSecret = "short" }, "at least 32 bytes"},
+		{"refresh shorter than access", func(c *Config) { c.Auth.RefreshTokenExpiration = c.Auth.TokenExpiration }, "auth.refresh_token_expiration"},
+		{"oidc without audience", func(c *Config) { c.Auth.OIDC.Issuer = "https://idp.example" }, "auth.oidc.audience"},
+		{"oidc refresh interval", func(c *Config) {
+			c.Auth.OIDC.Issuer = "https://idp.example"
+			c.Auth.OIDC.Audience = "gateway"
+			c.Auth.OIDC.RefreshInterval = 0
+		}, "auth.oidc.refresh_interval"},
+		{"rate limit algorithm", func(c *Config) { c.RateLimiting.Algorithm = "leaky_bucket" }, "rate_limiting.algorithm"},
+		{"breaker cooldown", func(c *Config) { c.RateLimiting.BreakerCooldown = -time.Second }, "rate_limiting.breaker_cooldown"},
+		{"unnamed policy", func(c *Config) {
+			c.RateLimiting.Policies = []RateLimitPolicy{{RequestsPerMinute: 10}}
+		}, "every policy needs a name"},
+		{"undefined default plan", func(c *Config) { c.Quotas.DefaultPlan = "platinum" }, "quotas.default_plan"},
+		{"critical reserve", func(c *Config) { c.Concurrency.CriticalReserve = 1 }, "concurrency.critical_reserve"},
+		{"ip filter range", func(c *Config) { c.IPFilter.Deny = []string{"10.0.0.1/8/8"} }, "ip_filter"},
+		{"otlp without endpoint", func(c *Config) {
+			c.Tracing.Exporter = "otlp"
+			c.Tracing.Endpoint = ""
+		}, "tracing.endpoint"},
+		{"sample ratio", func(c *Config) { c.Tracing.SampleRatio = 1.5 }, "tracing.sample_ratio"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.modify(cfg)
+			err := cfg.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate error = %v, want one mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := validConfig()
+	cfg.Server.Port = "0"
+	cfg.Services.OrderServiceURL = ""
+	cfg.Tracing.ServiceName = ""
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate accepted an invalid configuration")
+	}
+	for _, want := range []string{"server.port", "services.order_service_url", "tracing.service_name"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate error = %v, want it to mention %q", err, want)
+		}
+	}
+}
+
+func TestLoadEnvironment(t *testing.T) {
+	t.Setenv("GATEWAY_ENV", EnvironmentDevelopment)
+	t.Setenv("RATE_LIMIT", " 120 ")
+	t.Setenv("JWT_EXPIRATION", "5m")
+	t.Setenv("PROXY_PROTOCOL", "true")
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.168.0.1")
+	t.Setenv("CONCURRENCY_ORDERS", "7")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.RateLimiting.RequestsPerMinute != 120 {
+		t.Errorf("requests_per_minute = %d, want 120", cfg.RateLimiting.RequestsPerMinute)
+	}
+	if cfg.Auth.TokenExpiration != 5*time.Minute {
+		t.Errorf("token_expiration = %v, want 5m", cfg.Auth.TokenExpiration)
+	}
+	if !cfg.Server.ProxyProtocol || len(cfg.Server.TrustedProxies) != 2 {
+		t.Errorf("proxy_protocol = %v, trusted_proxies = %v", cfg.Server.ProxyProtocol, cfg.Server.TrustedProxies)
+	}
+	if cfg.Concurrency.Groups["orders"] != 7 {
+		t.Errorf("concurrency.groups.orders = %d, want 7", cfg.Concurrency.Groups["orders"])
+	}
+}
+
+func TestLoadEnvironmentErrors(t *testing.T) {
+	t.Setenv("GATEWAY_ENV", EnvironmentDevelopment)
+	t.Setenv("RATE_LIMIT", "ten")
+	t.Setenv("JWT_EXPIRATION", "15")
+	t.Setenv("PROXY_PROTOCOL", "maybe")
+	t.Setenv("TRACING_SAMPLE_RATIO", "half")
+
+	_, err := Load("")
+	if err == nil {
+		t.Fatal("Load accepted malformed environment variables")
+	}
+	for _, want := range []string{
+		`invalid environment`,
+		`RATE_LIMIT: "ten" is not an integer`,
+		`JWT_EXPIRATION: "15" is not a duration`,
+		`PROXY_PROTOCOL: "maybe" is not a boolean`,
+		`TRACING_SAMPLE_RATIO: "half" is not a number`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Load error = %v, want it to mention %q", err, want)
+		}
+	}
+}
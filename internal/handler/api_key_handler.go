@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hsibAD/api-gateway/internal/auth"
+	"github.com/hsibAD/api-gateway/internal/problem"
+	"github.com/hsibAD/api-gateway/internal/user"
+)
+
+type APIKeyHandler struct {
+	apiKeys *auth.APIKeyStore
+}
+
+func NewAPIKeyHandler(apiKeys *auth.APIKeyStore) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeys: apiKeys,
+	}
+}
+
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	var request struct {
+		Name      string     `json:"name" binding:"required,max=100"`
+		OwnerID   string     `json:"owner_id" binding:"required,max=100"`
+		Role      string     `json:"role" binding:"omitempty,max=50"`
+		Scopes    []string   `json:"scopes" binding:"dive,required,max=100"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		bindError(c, err)
+		return
+	}
+
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+		problem.Abort(c, http.StatusBadRequest, "expires_at must be in the future")
+		return
+	}
+	if request.Role == "" {
+		request.Role = user.RoleUser
+	}
+	if request.Scopes == nil {
+		request.Scopes = []string{}
+	}
+
+	key := &auth.APIKey{
+		Name:      request.Name,
+		OwnerID:   request.OwnerID,
+		Role:      request.Role,
+		Scopes:    request.Scopes,
+		ExpiresAt: request.ExpiresAt,
+	}
+
+	rawKey, err := h.apiKeys.Create(c.Request.Context(), key)
+	if err != nil {
+		problem.Abort(c, http.StatusInternalServerError, "failed to create API key")
+		return
+	}
+
+	// The raw key is never retrievable again.
+	c.JSON(http.StatusCreated, gin.H{
+		"api_key": rawKey,
+		"key":     key,
+	})
+}
+
+func (h *APIKeyHandler) ListAPIKeys(c *gin.Context) {
+	keys, err := h.apiKeys.List(c.Request.Context(), c.Query("owner_id"))
+	if err != nil {
+		problem.Abort(c, http.StatusInternalServerError, "failed to list API keys")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	if err := h.apiKeys.Revoke(c.Request.Context(), c.Param("id")); err != nil {
+		if errors.Is(err, auth.ErrAPIKeyNotFound) {
+			problem.Abort(c, http.StatusNotFound, err.Error())
+			return
+		}
+		problem.Abort(c, http.StatusInternalServerError, "failed to revoke API key")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
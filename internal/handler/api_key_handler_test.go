@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/hsibAD/api-gateway/internal/auth"
+	"github.com/hsibAD/api-gateway/internal/config"
+)
+
+// newAPIKeyRouter mounts the admin API key endpoints behind the auth
+// middleware and testPolicy, as the server does, and returns the raw keys
+// of an admin and a plain user to call them with. GET /me answers 204 to
+// any request the auth middleware lets through.
+func newAPIKeyRouter(t *testing.T) (router *gin.Engine, adminKey, userKey string) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	apiKeys := auth.NewAPIKeyStore(client)
+	jwtAuth, err := auth.NewJWTAuth(&config.AuthConfig{
+		JWTSecret:       "0123456789abcdef0123456789abcdef",
+		SigningKeys:     []config.SigningKeyConfig{{ID: "test", Algorithm: "HS256"}},
+		TokenExpiration: time.Minute,
+	}, nil, apiKeys)
+	if err != nil {
+		t.Fatalf("NewJWTAuth: %v", err)
+	}
+	for role, raw := range map[string]*string{"admin": &adminKey, "user": &userKey} {
+		if *raw, err = apiKeys.Create(context.Background(), &auth.APIKey{Name: role, OwnerID: role + "-owner", Role: role}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	h := NewAPIKeyHandler(apiKeys)
+	require := testPolicy.Require
+	router = gin.New()
+	protected := router.Group("", jwtAuth.Middleware())
+	protected.GET("/me", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	protected.POST("/admin/api-keys", require("api-keys:manage"), h.CreateAPIKey)
+	protected.GET("/admin/api-keys", require("api-keys:read"), h.ListAPIKeys)
+	protected.DELETE("/admin/api-keys/:id", require("api-keys:manage"), h.RevokeAPIKey)
+	return router, adminKey, userKey
+}
+
+// serveWithKey sends a request authenticated by an API key.
+func serveWithKey(router *gin.Engine, rawKey, method, path, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-API-Key", rawKey)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+	return w
+}
+
+type apiKeyResponse struct {
+	ID         string   `json:"id"`
+	OwnerID    string   `json:"owner_id"`
+	Role       string   `json:"role"`
+	Scopes     []string `json:"scopes"`
+	SecretHash string   `json:"secret_hash"`
+}
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	router, adminKey, _ := newAPIKeyRouter(t)
+
+	w := serveWithKey(router, adminKey, http.MethodPost, "/admin/api-keys", `{"name":"ci","owner_id":"u1","scopes":["orders:read"]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create status %d, want 201: %s", w.Code, w.Body)
+	}
+	var created struct {
+		APIKey string         `json:"api_key"`
+		Key    apiKeyResponse `json:"key"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+	if !strings.HasPrefix(created.APIKey, "agw_"+created.Key.ID+".") {
+		t.Errorf("api_key %q, want agw_%s.<secret>", created.APIKey, created.Key.ID)
+	}
+	if created.Key.OwnerID != "u1" || created.Key.Role != "user" || len(created.Key.Scopes) != 1 || created.Key.SecretHash != "" {
+		t.Errorf("key = %+v, want owner u1, the default role user, one scope and no hash", created.Key)
+	}
+
+	// The new key authenticates; a wrong secret for it does not.
+	if w := serveWithKey(router, created.APIKey, http.MethodGet, "/me", ""); w.Code != http.StatusNoContent {
+		t.Errorf("new key status %d, want 204", w.Code)
+	}
+	if w := serveWithKey(router, "agw_"+created.Key.ID+".wrong", http.MethodGet, "/me", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("wrong secret status %d, want 401", w.Code)
+	}
+
+	w = serveWithKey(router, adminKey, http.MethodGet, "/admin/api-keys?owner_id=u1", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("list status %d, want 200: %s", w.Code, w.Body)
+	}
+	var listed struct {
+		Keys []apiKeyResponse `json:"keys"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &listed); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+	if len(listed.Keys) != 1 || listed.Keys[0].ID != created.Key.ID || listed.Keys[0].SecretHash != "" {
+		t.Errorf("keys of u1 = %+v, want only %s without its hash", listed.Keys, created.Key.ID)
+	}
+
+	if w := serveWithKey(router, adminKey, http.MethodDelete, "/admin/api-keys/"+created.Key.ID, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("revoke status %d, want 204: %s", w.Code, w.Body)
+	}
+	if w := serveWithKey(router, created.APIKey, http.MethodGet, "/me", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("revoked key status %d, want 401", w.Code)
+	}
+	if w := serveWithKey(router, adminKey, http.MethodDelete, "/admin/api-keys/"+created.Key.ID, ""); w.Code != http.StatusNotFound {
+		t.Errorf("second revoke status %d, want 404", w.Code)
+	}
+}
+
+func TestAPIKeyAdminRoutes(t *testing.T) {
+	router, adminKey, userKey := newAPIKeyRouter(t)
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	tests := []struct {
+		name   string
+		rawKey string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"create", adminKey, http.MethodPost, "/admin/api-keys", `{"name":"ci","owner_id":"u1"}`, http.StatusCreated},
+		{"create expiring", adminKey, http.MethodPost, "/admin/api-keys", `{"name":"ci","owner_id":"u1","expires_at":"` + future + `"}`, http.StatusCreated},
+		{"create expired", adminKey, http.MethodPost, "/admin/api-keys", `{"name":"ci","owner_id":"u1","expires_at":"` + past + `"}`, http.StatusBadRequest},
+		{"create without a name", adminKey, http.MethodPost, "/admin/api-keys", `{"owner_id":"u1"}`, http.StatusBadRequest},
+		{"create without an owner", adminKey, http.MethodPost, "/admin/api-keys", `{"name":"ci"}`, http.StatusBadRequest},
+		{"create with an empty scope", adminKey, http.MethodPost, "/admin/api-keys", `{"name":"ci","owner_id":"u1","scopes":[""]}`, http.StatusBadRequest},
+		{"revoke unknown", adminKey, http.MethodDelete, "/admin/api-keys/unknown", "", http.StatusNotFound},
+		{"user creates", userKey, http.MethodPost, "/admin/api-keys", `{"name":"ci","owner_id":"u1"}`, http.StatusForbidden},
+		{"user lists", userKey, http.MethodGet, "/admin/api-keys", "", http.StatusForbidden},
+		{"user revokes", userKey, http.MethodDelete, "/admin/api-keys/unknown", "", http.StatusForbidden},
+		{"unknown key lists", "agw_unknown.secret", http.MethodGet, "/admin/api-keys", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serveWithKey(router, tt.rawKey, tt.method, tt.path, tt.body); w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hsibAD/api-gateway/internal/auth"
+	"github.com/hsibAD/api-gateway/internal/problem"
+	"github.com/hsibAD/api-gateway/internal/user"
+)
+
+type AuthHandler struct {
+	users         user.Store
+	jwtAuth       *auth.JWTAuth
+	refreshTokens *auth.RefreshTokenStore
+	denylist      *auth.Denylist
+}
+
+func NewAuthHandler(users user.Store, jwtAuth *auth.JWTAuth, refreshTokens *auth.RefreshTokenStore, denylist *auth.Denylist) *AuthHandler {
+	return &AuthHandler{
+		users:         users,
+		jwtAuth:       jwtAuth,
+		refreshTokens: refreshTokens,
+		denylist:      denylist,
+	}
+}
+
+func (h *AuthHandler) Register(c *gin.Context) {
+	var request struct {
+		Email    string `json:"email" binding:"required,email,max=254"`
+		Password string `json:"password" binding:"required,min=8,max=72"`
+		Name     string `json:"name" binding:"required,max=100"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		bindError(c, err)
+		return
+	}
+
+	hash, err := user.HashPassword(request.Password)
+	if err != nil {
+		problem.Abort(c, http.StatusInternalServerError, "failed to register user")
+		return
+	}
+
+	id, err := user.NewID()
+	if err != nil {
+		problem.Abort(c, http.StatusInternalServerError, "failed to register user")
+		return
+	}
+
+	newUser := &user.User{
+		ID:           id,
+		Email:        user.NormalizeEmail(request.Email),
+		Name:         request.Name,
+		Role:         user.RoleUser,
+		PasswordHash: hash,
+		CreatedAt:    time.Now().UTC(),
+	}
+
+	if err := h.users.Create(c.Request.Context(), newUser); err != nil {
+		if errors.Is(err, user.ErrEmailTaken) {
+			problem.Abort(c, http.StatusConflict, err.Error())
+			return
+		}
+		problem.Abort(c, http.StatusInternalServerError, "failed to register user")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id":         newUser.ID,
+		"email":      newUser.Email,
+		"name":       newUser.Name,
+		"role":       newUser.Role,
+		"created_at": newUser.CreatedAt,
+	})
+}
+
+func (h *AuthHandler) Login(c *gin.Context) {
+	var request struct {
+		Email    string `json:"email" binding:"required,email"`
+		Password string `json:"password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		bindError(c, err)
+		return
+	}
+
+	account, err := h.users.GetByEmail(c.Request.Context(), request.Email)
+	if err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			user.CheckDummyPassword(request.Password)
+			auth.RecordFailure(auth.FailureInvalidCredentials)
+			problem.Abort(c, http.StatusUnauthorized, "invalid email or password")
+			return
+		}
+		problem.Abort(c, http.StatusInternalServerError, "login failed")
+		return
+	}
+
+	if err := user.CheckPassword(account.PasswordHash, request.Password); err != nil {
+		auth.RecordFailure(auth.FailureInvalidCredentials)
+		problem.Abort(c, http.StatusUnauthorized, "invalid email or password")
+		return
+	}
+
+	refreshToken, refreshExpiresAt, err := h.refreshTokens.Issue(c.Request.Context(), account.ID)
+	if err != nil {
+		problem.Abort(c, http.StatusInternalServerError, "login failed")
+		return
+	}
+
+	h.respondWithTokens(c, account, refreshToken, refreshExpiresAt)
+}
+
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var request struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		bindError(c, err)
+		return
+	}
+
+	session, refreshToken, refreshExpiresAt, err := h.refreshTokens.Rotate(c.Request.Context(), request.RefreshToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrRefreshTokenReused):
+			auth.RecordFailure(auth.FailureRefreshTokenReused)
+			problem.Abort(c, http.StatusUnauthorized, "refresh token reuse detected, session revoked")
+		case errors.Is(err, auth.ErrInvalidRefreshToken):
+			auth.RecordFailure(auth.FailureInvalidRefreshToken)
+			problem.Abort(c, http.StatusUnauthorized, err.Error())
+		default:
+			problem.Abort(c, http.StatusInternalServerError, "token refresh failed")
+		}
+		return
+	}
+
+	// Reload the account so role changes and deletions take effect on refresh.
+	account, err := h.users.GetByID(c.Request.Context(), session.UserID)
+	if err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			h.refreshTokens.RevokeFamily(c.Request.Context(), session.FamilyID)
+			auth.RecordFailure(auth.FailureInvalidRefreshToken)
+			problem.Abort(c, http.StatusUnauthorized, auth.ErrInvalidRefreshToken.Error())
+			return
+		}
+		problem.Abort(c, http.StatusInternalServerError, "token refresh failed")
+		return
+	}
+
+	h.respondWithTokens(c, account, refreshToken, refreshExpiresAt)
+}
+
+// Logout revokes the presented access token and, if supplied, the refresh
+// token session it was obtained with.
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var request struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			bindError(c, err)
+			return
+		}
+	}
+
+	// API key clients have no session to end.
+	claims, ok := c.Get("claims")
+	if !ok {
+		problem.Abort(c, http.StatusBadRequest, "logout requires a bearer token")
+		return
+	}
+
+	if err := h.denylist.RevokeToken(c.Request.Context(), claims.(*auth.Claims)); err != nil {
+		problem.Abort(c, http.StatusInternalServerError, "logout failed")
+		return
+	}
+
+	if request.RefreshToken != "" {
+		if err := h.refreshTokens.Revoke(c.Request.Context(), request.RefreshToken); err != nil {
+			problem.Abort(c, http.StatusInternalServerError, "logout failed")
+			return
+		}
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RevokeUserTokens invalidates every access and refresh token issued to the
+// user so far. Intended for admins, e.g. when an account is compromised.
+func (h *AuthHandler) RevokeUserTokens(c *gin.Context) {
+	userID := c.Param("id")
+
+	if _, err := h.users.GetByID(c.Request.Context(), userID); err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			problem.Abort(c, http.StatusNotFound, err.Error())
+			return
+		}
+		problem.Abort(c, http.StatusInternalServerError, "failed to revoke tokens")
+		return
+	}
+
+	if err := h.denylist.RevokeUser(c.Request.Context(), userID); err != nil {
+		problem.Abort(c, http.StatusInternalServerError, "failed to revoke tokens")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// JWKS publishes the token verification keys for downstream services.
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.jwtAuth.JWKS())
+}
+
+// ReloadSigningKeys re-reads the signing key set, promoting whichever key is
+// now listed first. Tokens signed by keys still in the set remain valid.
+func (h *AuthHandler) ReloadSigningKeys(c *gin.Context) {
+	keys, err := h.jwtAuth.ReloadKeys()
+	if err != nil {
+		problem.Abort(c, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"active_kid": keys.Active().ID,
+		"kids":       keys.IDs(),
+	})
+}
+
+func (h *AuthHandler) respondWithTokens(c *gin.Context, account *user.User, refreshToken string, refreshExpiresAt time.Time) {
+	token, expiresAt, err := h.jwtAuth.GenerateToken(account.ID, account.Role)
+	if err != nil {
+		problem.Abort(c, http.StatusInternalServerError, "failed to issue token")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"access_token":             token,
+		"token_type":               "Bearer",
+		"expires_at":               expiresAt.UTC(),
+		"expires_in":               int64(time.Until(expiresAt).Seconds()),
+		"refresh_token":            refreshToken,
+		"refresh_token_expires_at": refreshExpiresAt.UTC(),
+	})
+}
@@ -0,0 +1,283 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/hsibAD/api-gateway/internal/auth"
+	"github.com/hsibAD/api-gateway/internal/config"
+	"github.com/hsibAD/api-gateway/internal/user"
+)
+
+// newAuthRouter serves the auth endpoints over an in-memory user store and
+// a miniredis-backed denylist and refresh token store. GET /me answers 204
+// to any request the auth middleware lets through.
+func newAuthRouter(t *testing.T) (*gin.Engine, user.Store) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	cfg := &config.AuthConfig{
+		JWTSecret:              "0123456789abcdef0123456789abcdef",
+		SigningKeys:            []config.SigningKeyConfig{{ID: "test", Algorithm: "HS256"}},
+		TokenExpiration:        time.Minute,
+		RefreshTokenExpiration: time.Hour,
+		DenylistCacheSize:      100,
+		DenylistCacheTTL:       time.Minute,
+	}
+	denylist := auth.NewDenylist(client, cfg)
+	jwtAuth, err := auth.NewJWTAuth(cfg, denylist, nil)
+	if err != nil {
+		t.Fatalf("NewJWTAuth: %v", err)
+	}
+	users := user.NewMemoryStore()
+	h := NewAuthHandler(users, jwtAuth, auth.NewRefreshTokenStore(client, cfg), denylist)
+
+	router := gin.New()
+	router.POST("/auth/register", h.Register)
+	router.POST("/auth/login", h.Login)
+	router.POST("/auth/refresh", h.Refresh)
+	router.POST("/auth/logout", jwtAuth.Middleware(), h.Logout)
+	router.GET("/me", jwtAuth.Middleware(), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	router.POST("/users/:id/revoke-tokens", h.RevokeUserTokens)
+	// API key clients reach logout authenticated but without claims.
+	router.POST("/auth/logout-api-key", withIdentity, h.Logout)
+	return router, users
+}
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// postJSON sends body, with a bearer token if one is given.
+func postJSON(router *gin.Engine, path, token, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+	return w
+}
+
+func decodeTokens(t *testing.T, w *httptest.ResponseRecorder) tokenResponse {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", w.Code, w.Body)
+	}
+	var tokens tokenResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &tokens); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+	return tokens
+}
+
+// registerAndLogin creates an account and returns its ID and tokens.
+func registerAndLogin(t *testing.T, router *gin.Engine, email string) (string, tokenResponse) {
+	t.Helper()
+	w := postJSON(router, "/auth/register", "", `{"email":"`+email+`","password":"correct horse","name":"Test"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register status %d, want 201: %s", w.Code, w.Body)
+	}
+	var account struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &account)
+	return account.ID, login(t, router, email)
+}
+
+func login(t *testing.T, router *gin.Engine, email string) tokenResponse {
+	t.Helper()
+	return decodeTokens(t, postJSON(router, "/auth/login", "", `{"email":"`+email+`","password":"correct horse"}`))
+}
+
+// authenticated reports whether the auth middleware accepts token.
+func authenticated(t *testing.T, router *gin.Engine, token string) bool {
+	t.Helper()
+	request := httptest.NewRequest(http.MethodGet, "/me", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+	return w.Code == http.StatusNoContent
+}
+
+func TestRegister(t *testing.T) {
+	router, users := newAuthRouter(t)
+
+	w := postJSON(router, "/auth/register", "", `{"email":"Ada@Example.com","password":"correct horse","name":"Ada"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("register status %d, want 201: %s", w.Code, w.Body)
+	}
+	var account struct {
+		ID    string `json:"id"`
+		Email string `json:"email"`
+		Name  string `json:"name"`
+		Role  string `json:"role"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &account); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+	if account.Email != "ada@example.com" || account.Name != "Ada" || account.Role != user.RoleUser {
+		t.Errorf("account = %+v, want ada@example.com, Ada, %s", account, user.RoleUser)
+	}
+	if strings.Contains(w.Body.String(), "password") {
+		t.Errorf("response exposes the password hash: %s", w.Body)
+	}
+	stored, err := users.GetByID(context.Background(), account.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if user.CheckPassword(stored.PasswordHash, "correct horse") != nil {
+		t.Errorf("stored hash does not match the password")
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"taken email", `{"email":"ada@example.com","password":"correct horse","name":"Ada"}`, http.StatusConflict},
+		{"taken email in another case", `{"email":"ADA@example.com","password":"correct horse","name":"Ada"}`, http.StatusConflict},
+		{"invalid email", `{"email":"ada","password":"correct horse","name":"Ada"}`, http.StatusBadRequest},
+		{"short password", `{"email":"bob@example.com","password":"short","name":"Bob"}`, http.StatusBadRequest},
+		{"password over 72 bytes", `{"email":"bob@example.com","password":"` + strings.Repeat("a", 73) + `","name":"Bob"}`, http.StatusBadRequest},
+		{"missing name", `{"email":"bob@example.com","password":"correct horse"}`, http.StatusBadRequest},
+		{"malformed body", `{"email":`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := postJSON(router, "/auth/register", "", tt.body); w.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestLogin(t *testing.T) {
+	router, _ := newAuthRouter(t)
+	_, tokens := registerAndLogin(t, router, "ada@example.com")
+	if tokens.AccessToken == "" || tokens.RefreshToken == "" {
+		t.Fatalf("login tokens = %+v, want both", tokens)
+	}
+	if !authenticated(t, router, tokens.AccessToken) {
+		t.Errorf("access token from login rejected")
+	}
+	refreshed := decodeTokens(t, postJSON(router, "/auth/refresh", "", `{"refresh_token":"`+tokens.RefreshToken+`"}`))
+	if !authenticated(t, router, refreshed.AccessToken) {
+		t.Errorf("access token from refresh rejected")
+	}
+
+	// A wrong password and an unknown email get the same answer.
+	wrongPassword := postJSON(router, "/auth/login", "", `{"email":"ada@example.com","password":"wrong horse"}`)
+	unknownEmail := postJSON(router, "/auth/login", "", `{"email":"bob@example.com","password":"correct horse"}`)
+	for name, w := range map[string]*httptest.ResponseRecorder{"wrong password": wrongPassword, "unknown email": unknownEmail} {
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s status %d, want 401", name, w.Code)
+		}
+	}
+	if wrongPassword.Body.String() != unknownEmail.Body.String() {
+		t.Errorf("wrong password body %s differs from unknown email body %s", wrongPassword.Body, unknownEmail.Body)
+	}
+
+	if w := postJSON(router, "/auth/login", "", `{"email":"ada@example.com"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("login without a password status %d, want 400", w.Code)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           func(tokens tokenResponse) string
+		refreshRevoked bool
+	}{
+		{"with the refresh token", func(tokens tokenResponse) string { return `{"refresh_token":"` + tokens.RefreshToken + `"}` }, true},
+		{"access token only", func(tokenResponse) string { return "" }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, _ := newAuthRouter(t)
+			_, tokens := registerAndLogin(t, router, "ada@example.com")
+			other := login(t, router, "ada@example.com")
+
+			if w := postJSON(router, "/auth/logout", tokens.AccessToken, tt.body(tokens)); w.Code != http.StatusNoContent {
+				t.Fatalf("logout status %d, want 204: %s", w.Code, w.Body)
+			}
+			if authenticated(t, router, tokens.AccessToken) {
+				t.Errorf("access token accepted after logout")
+			}
+			refreshed := postJSON(router, "/auth/refresh", "", `{"refresh_token":"`+tokens.RefreshToken+`"}`)
+			if got := refreshed.Code == http.StatusUnauthorized; got != tt.refreshRevoked {
+				t.Errorf("refresh after logout status %d, want revoked %v", refreshed.Code, tt.refreshRevoked)
+			}
+			// Other sessions of the same user are not affected.
+			if !authenticated(t, router, other.AccessToken) {
+				t.Errorf("another session's access token rejected after logout")
+			}
+		})
+	}
+}
+
+func TestLogoutRejects(t *testing.T) {
+	router, _ := newAuthRouter(t)
+	_, tokens := registerAndLogin(t, router, "ada@example.com")
+
+	if w := postJSON(router, "/auth/logout", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("logout without a token status %d, want 401", w.Code)
+	}
+	if w := postJSON(router, "/auth/logout", tokens.AccessToken, `{"refresh_token":`); w.Code != http.StatusBadRequest {
+		t.Errorf("logout with a malformed body status %d, want 400", w.Code)
+	}
+	request := httptest.NewRequest(http.MethodPost, "/auth/logout-api-key", nil)
+	request.Header.Set("X-Test-User", "u1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("logout with an API key status %d, want 400", w.Code)
+	}
+}
+
+func TestRevokeUserTokens(t *testing.T) {
+	router, _ := newAuthRouter(t)
+	id, tokens := registerAndLogin(t, router, "ada@example.com")
+	_, bystander := registerAndLogin(t, router, "bob@example.com")
+
+	// Access tokens from the revocation's own second stay valid, as iat has
+	// one-second resolution; move past the second these were issued in.
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	if w := postJSON(router, "/users/"+id+"/revoke-tokens", "", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("revoke status %d, want 204: %s", w.Code, w.Body)
+	}
+	if authenticated(t, router, tokens.AccessToken) {
+		t.Errorf("access token accepted after the user's tokens were revoked")
+	}
+	if w := postJSON(router, "/auth/refresh", "", `{"refresh_token":"`+tokens.RefreshToken+`"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("refresh after revocation status %d, want 401", w.Code)
+	}
+	if !authenticated(t, router, bystander.AccessToken) {
+		t.Errorf("another user's token rejected")
+	}
+
+	// Logging in again right away, within the same second, works.
+	again := login(t, router, "ada@example.com")
+	if !authenticated(t, router, again.AccessToken) {
+		t.Errorf("access token from a login right after the revocation rejected")
+	}
+	if w := postJSON(router, "/auth/refresh", "", `{"refresh_token":"`+again.RefreshToken+`"}`); w.Code != http.StatusOK {
+		t.Errorf("refresh of a login right after the revocation status %d, want 200", w.Code)
+	}
+
+	if w := postJSON(router, "/users/nobody/revoke-tokens", "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("revoke of an unknown user status %d, want 404", w.Code)
+	}
+}
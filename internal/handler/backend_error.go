@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hsibAD/api-gateway/internal/problem"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// statusClientClosedRequest is nginx's status for a client that hung up
+// before the response was ready; no one reads it but the access log.
+const statusClientClosedRequest = 499
+
+type backendCode struct {
+	status int
+	name   string
+	// public codes describe a problem with the request, so the backend's
+	// message is meant for the caller. Other messages may carry internals
+	// and are replaced with a generic one.
+	public bool
+}
+
+var backendCodes = map[codes.Code]backendCode{
+	codes.Canceled:           {statusClientClosedRequest, "canceled", false},
+	codes.Unknown:            {http.StatusInternalServerError, "unknown", false},
+	codes.InvalidArgument:    {http.StatusBadRequest, "invalid_argument", true},
+	codes.DeadlineExceeded:   {http.StatusGatewayTimeout, "deadline_exceeded", false},
+	codes.NotFound:           {http.StatusNotFound, "not_found", false},
+	codes.AlreadyExists:      {http.StatusConflict, "already_exists", true},
+	codes.PermissionDenied:   {http.StatusForbidden, "permission_denied", true},
+	codes.ResourceExhausted:  {http.StatusTooManyRequests, "resource_exhausted", true},
+	codes.FailedPrecondition: {http.StatusBadRequest, "failed_precondition", true},
+	codes.Aborted:            {http.StatusConflict, "aborted", true},
+	codes.OutOfRange:         {http.StatusBadRequest, "out_of_range", true},
+	codes.Unimplemented:      {http.StatusNotImplemented, "unimplemented", false},
+	codes.Internal:           {http.StatusInternalServerError, "internal", false},
+	codes.Unavailable:        {http.StatusServiceUnavailable, "unavailable", false},
+	codes.DataLoss:           {http.StatusInternalServerError, "data_loss", false},
+	codes.Unauthenticated:    {http.StatusUnauthorized, "unauthenticated", true},
+}
+
+type fieldViolation struct {
+	Field       string `json:"field"`
+	Description string `json:"description"`
+}
+
+type preconditionViolation struct {
+	Type        string `json:"type"`
+	Subject     string `json:"subject"`
+	Description string `json:"description"`
+}
+
+// backendError answers a failed call to a backend service with the HTTP
+// status matching its gRPC code. The problem carries the code's name plus
+// field_violations, precondition_failures and retry_after when the backend
+// attached them.
+func backendError(c *gin.Context, err error) {
+	st := status.Convert(err)
+	// The backend's message could differ from the 404 for a resource owned
+	// by someone else, which would show that the ID exists.
+	if st.Code() == codes.NotFound {
+		notFound(c)
+		return
+	}
+
+	code, ok := backendCodes[st.Code()]
+	if !ok {
+		code = backendCodes[codes.Unknown]
+	}
+
+	message := st.Message()
+	if !code.public || message == "" {
+		fmt.Printf("Backend call %s %s failed (request %s): %v\n", c.Request.Method, c.FullPath(), c.GetString("request_id"), err)
+		message = strings.ToLower(problem.Title(code.status))
+	}
+
+	fields := gin.H{"code": code.name}
+	for _, detail := range st.Details() {
+		switch detail := detail.(type) {
+		case *errdetails.BadRequest:
+			if !code.public {
+				continue
+			}
+			violations := make([]fieldViolation, 0, len(detail.GetFieldViolations()))
+			for _, v := range detail.GetFieldViolations() {
+				violations = append(violations, fieldViolation{Field: v.GetField(), Description: v.GetDescription()})
+			}
+			fields["field_violations"] = violations
+		case *errdetails.PreconditionFailure:
+			if !code.public {
+				continue
+			}
+			violations := make([]preconditionViolation, 0, len(detail.GetViolations()))
+			for _, v := range detail.GetViolations() {
+				violations = append(violations, preconditionViolation{Type: v.GetType(), Subject: v.GetSubject(), Description: v.GetDescription()})
+			}
+			fields["precondition_failures"] = violations
+		case *errdetails.RetryInfo:
+			if delay := detail.GetRetryDelay(); delay != nil {
+				seconds := int(math.Ceil(delay.AsDuration().Seconds()))
+				c.Header("Retry-After", strconv.Itoa(seconds))
+				fields["retry_after"] = seconds
+			}
+		}
+	}
+
+	problem.AbortWithFields(c, code.status, message, fields)
+}
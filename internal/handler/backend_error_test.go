@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	orderpb "github.com/hsibAD/order-service/proto"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/runtime/protoiface"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// serveBackendError answers a request with backendError(err) and decodes
+// the problem.
+func serveBackendError(t *testing.T, err error) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+	router := gin.New()
+	router.GET("/orders/:id", func(c *gin.Context) { backendError(c, err) })
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders/o1", nil))
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+	return w, body
+}
+
+func withDetails(t *testing.T, code codes.Code, message string, details ...protoiface.MessageV1) error {
+	t.Helper()
+	st, err := status.New(code, message).WithDetails(details...)
+	if err != nil {
+		t.Fatalf("WithDetails: %v", err)
+	}
+	return st.Err()
+}
+
+func TestBackendErrorCodes(t *testing.T) {
+	tests := []struct {
+		code   codes.Code
+		status int
+		name   string
+		detail string
+	}{
+		{codes.Canceled, statusClientClosedRequest, "canceled", "client closed request"},
+		{codes.Unknown, http.StatusInternalServerError, "unknown", "internal server error"},
+		{codes.InvalidArgument, http.StatusBadRequest, "invalid_argument", "backend says"},
+		{codes.DeadlineExceeded, http.StatusGatewayTimeout, "deadline_exceeded", "gateway timeout"},
+		{codes.NotFound, http.StatusNotFound, "not_found", "not found"},
+		{codes.AlreadyExists, http.StatusConflict, "already_exists", "backend says"},
+		{codes.PermissionDenied, http.StatusForbidden, "permission_denied", "backend says"},
+		{codes.ResourceExhausted, http.StatusTooManyRequests, "resource_exhausted", "backend says"},
+		{codes.FailedPrecondition, http.StatusBadRequest, "failed_precondition", "backend says"},
+		{codes.Aborted, http.StatusConflict, "aborted", "backend says"},
+		{codes.OutOfRange, http.StatusBadRequest, "out_of_range", "backend says"},
+		{codes.Unimplemented, http.StatusNotImplemented, "unimplemented", "not implemented"},
+		{codes.Internal, http.StatusInternalServerError, "internal", "internal server error"},
+		{codes.Unavailable, http.StatusServiceUnavailable, "unavailable", "service unavailable"},
+		{codes.DataLoss, http.StatusInternalServerError, "data_loss", "internal server error"},
+		{codes.Unauthenticated, http.StatusUnauthorized, "unauthenticated", "backend says"},
+		{codes.Code(99), http.StatusInternalServerError, "unknown", "internal server error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code.String(), func(t *testing.T) {
+			w, body := serveBackendError(t, status.Error(tt.code, "backend says"))
+			if w.Code != tt.status {
+				t.Errorf("status %d, want %d", w.Code, tt.status)
+			}
+			if body["code"] != tt.name || body["detail"] != tt.detail {
+				t.Errorf("code %v with detail %q, want %s with %q", body["code"], body["detail"], tt.name, tt.detail)
+			}
+		})
+	}
+
+	t.Run("not a status", func(t *testing.T) {
+		w, body := serveBackendError(t, errors.New("dial tcp 10.0.0.7:50051: connection refused"))
+		if w.Code != http.StatusInternalServerError || body["detail"] != "internal server error" {
+			t.Errorf("status %d with detail %q, want 500 hiding the error", w.Code, body["detail"])
+		}
+	})
+}
+
+func TestBackendErrorDetails(t *testing.T) {
+	badRequest := &errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{
+		{Field: "amount", Description: "must be positive"},
+	}}
+	precondition := &errdetails.PreconditionFailure{Violations: []*errdetails.PreconditionFailure_Violation{
+		{Type: "STATE", Subject: "order/o1", Description: "order is already paid"},
+	}}
+	retry := &errdetails.RetryInfo{RetryDelay: durationpb.New(1500 * time.Millisecond)}
+
+	t.Run("field violations", func(t *testing.T) {
+		_, body := serveBackendError(t, withDetails(t, codes.InvalidArgument, "invalid payment", badRequest))
+		violations, _ := body["field_violations"].([]interface{})
+		if len(violations) != 1 || violations[0].(map[string]interface{})["field"] != "amount" {
+			t.Errorf("field_violations = %v, want the amount violation", body["field_violations"])
+		}
+	})
+
+	t.Run("precondition failures", func(t *testing.T) {
+		_, body := serveBackendError(t, withDetails(t, codes.FailedPrecondition, "cannot pay", precondition))
+		violations, _ := body["precondition_failures"].([]interface{})
+		if len(violations) != 1 || violations[0].(map[string]interface{})["subject"] != "order/o1" {
+			t.Errorf("precondition_failures = %v, want the order violation", body["precondition_failures"])
+		}
+	})
+
+	t.Run("details of internal errors are hidden", func(t *testing.T) {
+		_, body := serveBackendError(t, withDetails(t, codes.Internal, "db: constraint payments_pkey", badRequest, precondition))
+		if _, ok := body["field_violations"]; ok {
+			t.Errorf("field_violations surfaced from an internal error")
+		}
+		if _, ok := body["precondition_failures"]; ok {
+			t.Errorf("precondition_failures surfaced from an internal error")
+		}
+	})
+
+	t.Run("retry info", func(t *testing.T) {
+		w, body := serveBackendError(t, withDetails(t, codes.Unavailable, "draining", retry))
+		if got := w.Header().Get("Retry-After"); got != "2" {
+			t.Errorf("Retry-After = %q, want 1.5s rounded up to 2", got)
+		}
+		if body["retry_after"] != float64(2) {
+			t.Errorf("retry_after = %v, want 2", body["retry_after"])
+		}
+	})
+}
+
+// A resource owned by someone else and one that does not exist must be
+// indistinguishable, or probing IDs would reveal which exist.
+func TestHiddenAndMissingLookAlike(t *testing.T) {
+	hidden := serveAs(newOrderRouter(&fakeOrderService{
+		orders: map[string]*orderpb.Order{"o1": {Id: "o1", UserId: "u1"}},
+	}), "u2", "user", http.MethodGet, "/orders/o1", "")
+	missing := serveAs(newOrderRouter(&fakeOrderService{}), "u2", "user", http.MethodGet, "/orders/o1", "")
+
+	if hidden.Code != http.StatusNotFound || missing.Code != http.StatusNotFound {
+		t.Fatalf("statuses %d and %d, want 404 for both", hidden.Code, missing.Code)
+	}
+	if hidden.Body.String() != missing.Body.String() {
+		t.Errorf("bodies differ:\nhidden:  %s\nmissing: %s", hidden.Body, missing.Body)
+	}
+	for _, header := range []string{"Content-Type", "Content-Length"} {
+		if hidden.Header().Get(header) != missing.Header().Get(header) {
+			t.Errorf("%s differs: %q and %q", header, hidden.Header().Get(header), missing.Header().Get(header))
+		}
+	}
+}
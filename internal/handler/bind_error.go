@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/hsibAD/api-gateway/internal/problem"
+)
+
+// bindError answers a request body that could not be bound. Validation
+// failures are listed per field, in the same shape as backend field
+// violations.
+func bindError(c *gin.Context, err error) {
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		problem.Abort(c, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+
+	violations := make([]fieldViolation, 0, len(validationErrors))
+	for _, fe := range validationErrors {
+		description := "must satisfy " + fe.Tag()
+		switch {
+		case fe.Tag() == "required":
+			description = "is required"
+		case fe.Param() != "":
+			description += "=" + fe.Param()
+		}
+		violations = append(violations, fieldViolation{Field: fe.Field(), Description: description})
+	}
+	problem.AbortWithFields(c, http.StatusBadRequest, "request validation failed", gin.H{
+		"field_violations": violations,
+	})
+}
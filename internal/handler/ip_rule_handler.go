@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hsibAD/api-gateway/internal/middleware"
+	"github.com/hsibAD/api-gateway/internal/problem"
+)
+
+type IPRuleHandler struct {
+	ipFilter *middleware.IPFilter
+}
+
+func NewIPRuleHandler(ipFilter *middleware.IPFilter) *IPRuleHandler {
+	return &IPRuleHandler{
+		ipFilter: ipFilter,
+	}
+}
+
+func (h *IPRuleHandler) ListIPRules(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"rules": h.ipFilter.Rules()})
+}
+
+func (h *IPRuleHandler) CreateIPRule(c *gin.Context) {
+	var request struct {
+		CIDR    string `json:"cidr" binding:"required,max=64"`
+		Action  string `json:"action" binding:"required,oneof=allow deny"`
+		Group   string `json:"group" binding:"omitempty,max=200"`
+		Comment string `json:"comment" binding:"omitempty,max=200"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		bindError(c, err)
+		return
+	}
+
+	rule := &middleware.IPRule{
+		CIDR:      request.CIDR,
+		Action:    request.Action,
+		Group:     request.Group,
+		Comment:   request.Comment,
+		CreatedBy: c.GetString("user_id"),
+	}
+
+	if err := h.ipFilter.Add(c.Request.Context(), rule); err != nil {
+		if errors.Is(err, middleware.ErrInvalidIPRule) {
+			problem.Abort(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		problem.Abort(c, http.StatusInternalServerError, "failed to create IP rule")
+		return
+	}
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+func (h *IPRuleHandler) DeleteIPRule(c *gin.Context) {
+	if err := h.ipFilter.Remove(c.Request.Context(), c.Param("id")); err != nil {
+		if errors.Is(err, middleware.ErrIPRuleNotFound) {
+			problem.Abort(c, http.StatusNotFound, err.Error())
+			return
+		}
+		problem.Abort(c, http.StatusInternalServerError, "failed to delete IP rule")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -3,20 +3,32 @@ package handler
 import (
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/hsibAD/api-gateway/internal/auth"
+	"github.com/hsibAD/api-gateway/internal/problem"
 	"github.com/hsibAD/api-gateway/internal/proxy"
 	pb "github.com/hsibAD/order-service/proto"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// addressPageSize is how many addresses checkAddressOwner asks for at once,
+// and addressMaxPages how many pages it reads before giving up.
+const (
+	addressPageSize = 100
+	addressMaxPages = 10
+)
+
 type OrderHandler struct {
 	orderClient *proxy.OrderServiceClient
+	ownership   ownership
 }
 
-func NewOrderHandler(orderClient *proxy.OrderServiceClient) *OrderHandler {
+func NewOrderHandler(orderClient *proxy.OrderServiceClient, policy *auth.Policy) *OrderHandler {
 	return &OrderHandler{
 		orderClient: orderClient,
+		ownership:   ownership{policy: policy},
 	}
 }
 
@@ -28,7 +40,7 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		bindError(c, err)
 		return
 	}
 
@@ -43,7 +55,7 @@ func (h *OrderHandler) CreateOrder(c *gin.Context) {
 
 	order, err := h.orderClient.CreateOrder(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		backendError(c, err)
 		return
 	}
 
@@ -58,7 +70,11 @@ func (h *OrderHandler) GetOrder(c *gin.Context) {
 
 	order, err := h.orderClient.GetOrder(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		backendError(c, err)
+		return
+	}
+
+	if !h.ownership.check(c, order.GetUserId(), "orders:read-any") {
 		return
 	}
 
@@ -72,7 +88,7 @@ func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		bindError(c, err)
 		return
 	}
 
@@ -83,7 +99,7 @@ func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
 
 	order, err := h.orderClient.UpdateOrderStatus(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		backendError(c, err)
 		return
 	}
 
@@ -93,7 +109,7 @@ func (h *OrderHandler) UpdateOrderStatus(c *gin.Context) {
 func (h *OrderHandler) AddDeliveryAddress(c *gin.Context) {
 	var address pb.DeliveryAddress
 	if err := c.ShouldBindJSON(&address); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		bindError(c, err)
 		return
 	}
 
@@ -102,13 +118,93 @@ func (h *OrderHandler) AddDeliveryAddress(c *gin.Context) {
 
 	result, err := h.orderClient.AddDeliveryAddress(c.Request.Context(), &address)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		backendError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusCreated, result)
 }
 
+// UpdateDeliveryAddress replaces an address of the caller. Ownership is
+// checked before the write, like SetDeliveryTime does for orders.
+func (h *OrderHandler) UpdateDeliveryAddress(c *gin.Context) {
+	var address pb.DeliveryAddress
+	if err := c.ShouldBindJSON(&address); err != nil {
+		bindError(c, err)
+		return
+	}
+
+	if !h.checkAddressOwner(c, c.Param("id"), "addresses:write-any") {
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	address.Id = c.Param("id")
+	address.UserId = userID.(string)
+
+	result, err := h.orderClient.UpdateDeliveryAddress(c.Request.Context(), &address)
+	if err != nil {
+		backendError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *OrderHandler) DeleteDeliveryAddress(c *gin.Context) {
+	if !h.checkAddressOwner(c, c.Param("id"), "addresses:write-any") {
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	req := &pb.DeleteAddressRequest{
+		AddressId: c.Param("id"),
+		UserId:    userID.(string),
+	}
+
+	if err := h.orderClient.DeleteDeliveryAddress(c.Request.Context(), req); err != nil {
+		backendError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// checkAddressOwner is ownership.check for addresses. The order service has
+// no lookup of a single address, so the caller's own addresses are paged
+// through instead, up to addressMaxPages pages so that a backend ignoring
+// the page number cannot keep the request looping; holders of
+// bypassPermission skip the lookup.
+func (h *OrderHandler) checkAddressOwner(c *gin.Context, addressID, bypassPermission string) bool {
+	if h.ownership.allowed(c, "", bypassPermission) {
+		return true
+	}
+
+	userID := c.GetString("user_id")
+	for page := int32(1); page <= addressMaxPages; page++ {
+		result, err := h.orderClient.ListDeliveryAddresses(c.Request.Context(), &pb.ListAddressesRequest{
+			UserId: userID,
+			Page:   page,
+			Limit:  addressPageSize,
+		})
+		if err != nil {
+			backendError(c, err)
+			return false
+		}
+		for _, address := range result.GetAddresses() {
+			if address.GetId() == addressID {
+				return true
+			}
+		}
+		if len(result.GetAddresses()) < addressPageSize {
+			break
+		}
+	}
+
+	notFound(c)
+	return false
+}
+
 func (h *OrderHandler) ListDeliveryAddresses(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
@@ -122,13 +218,53 @@ func (h *OrderHandler) ListDeliveryAddresses(c *gin.Context) {
 
 	result, err := h.orderClient.ListDeliveryAddresses(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		backendError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, result)
 }
 
+func (h *OrderHandler) SetDeliveryTime(c *gin.Context) {
+	orderID := c.Param("id")
+	var request struct {
+		DeliveryTime time.Time `json:"delivery_time" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		bindError(c, err)
+		return
+	}
+
+	if !request.DeliveryTime.After(time.Now()) {
+		problem.Abort(c, http.StatusBadRequest, "delivery_time must be in the future")
+		return
+	}
+
+	order, err := h.orderClient.GetOrder(c.Request.Context(), &pb.GetOrderRequest{OrderId: orderID})
+	if err != nil {
+		backendError(c, err)
+		return
+	}
+
+	if !h.ownership.check(c, order.GetUserId(), "orders:write-any") {
+		return
+	}
+
+	req := &pb.SetDeliveryTimeRequest{
+		OrderId:      orderID,
+		DeliveryTime: timestamppb.New(request.DeliveryTime),
+	}
+
+	order, err = h.orderClient.SetDeliveryTime(c.Request.Context(), req)
+	if err != nil {
+		backendError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
 func (h *OrderHandler) GetAvailableDeliverySlots(c *gin.Context) {
 	date := c.Query("date")
 	req := &pb.GetDeliverySlotsRequest{
@@ -137,7 +273,7 @@ func (h *OrderHandler) GetAvailableDeliverySlots(c *gin.Context) {
 
 	result, err := h.orderClient.GetAvailableDeliverySlots(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		backendError(c, err)
 		return
 	}
 
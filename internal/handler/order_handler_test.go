@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hsibAD/api-gateway/internal/auth"
+	"github.com/hsibAD/api-gateway/internal/proxy"
+	pb "github.com/hsibAD/order-service/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// testPolicy lets users work on their own resources; admins may touch any.
+var testPolicy = auth.NewPolicy(map[string][]string{
+	"user":   {"orders:read", "orders:write", "addresses:read", "addresses:write", "payments:read", "payments:write"},
+	"admin":  {"*"},
+	"viewer": {},
+})
+
+// withIdentity stands in for JWTAuth.Middleware, taking the caller from the
+// X-Test-User and X-Test-Role headers.
+func withIdentity(c *gin.Context) {
+	if user := c.GetHeader("X-Test-User"); user != "" {
+		c.Set("user_id", user)
+		c.Set("role", c.GetHeader("X-Test-Role"))
+	}
+}
+
+// serveAs sends a request as user with role through router.
+func serveAs(router *gin.Engine, user, role, method, path, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Test-User", user)
+	request.Header.Set("X-Test-Role", role)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+	return w
+}
+
+// fakeOrderService keeps orders and addresses in memory and records every
+// write it receives.
+type fakeOrderService struct {
+	pb.OrderServiceClient
+
+	orders    map[string]*pb.Order
+	addresses []*pb.DeliveryAddress
+	// ignorePage makes ListDeliveryAddresses always answer with the first page.
+	ignorePage bool
+	listCalls  int
+	writes     []string
+}
+
+func (f *fakeOrderService) GetOrder(ctx context.Context, in *pb.GetOrderRequest, opts ...grpc.CallOption) (*pb.Order, error) {
+	order, ok := f.orders[in.OrderId]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "order "+in.OrderId+" not found")
+	}
+	return order, nil
+}
+
+func (f *fakeOrderService) SetDeliveryTime(ctx context.Context, in *pb.SetDeliveryTimeRequest, opts ...grpc.CallOption) (*pb.Order, error) {
+	f.writes = append(f.writes, "delivery-time "+in.OrderId)
+	return f.orders[in.OrderId], nil
+}
+
+func (f *fakeOrderService) ListDeliveryAddresses(ctx context.Context, in *pb.ListAddressesRequest, opts ...grpc.CallOption) (*pb.ListAddressesResponse, error) {
+	f.listCalls++
+	var own []*pb.DeliveryAddress
+	for _, address := range f.addresses {
+		if address.UserId == in.UserId {
+			own = append(own, address)
+		}
+	}
+
+	start := int(in.Page-1) * int(in.Limit)
+	if f.ignorePage {
+		start = 0
+	}
+	if start >= len(own) {
+		return &pb.ListAddressesResponse{}, nil
+	}
+	end := start + int(in.Limit)
+	if end > len(own) {
+		end = len(own)
+	}
+	return &pb.ListAddressesResponse{Addresses: own[start:end]}, nil
+}
+
+func (f *fakeOrderService) UpdateDeliveryAddress(ctx context.Context, in *pb.DeliveryAddress, opts ...grpc.CallOption) (*pb.DeliveryAddress, error) {
+	f.writes = append(f.writes, "update "+in.Id)
+	return in, nil
+}
+
+func (f *fakeOrderService) DeleteDeliveryAddress(ctx context.Context, in *pb.DeleteAddressRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	f.writes = append(f.writes, "delete "+in.AddressId)
+	return &emptypb.Empty{}, nil
+}
+
+func newOrderRouter(backend *fakeOrderService) *gin.Engine {
+	h := NewOrderHandler(proxy.NewOrderServiceClientFrom(backend), testPolicy)
+
+	router := gin.New()
+	router.Use(withIdentity)
+	router.GET("/orders/:id", testPolicy.Require("orders:read"), h.GetOrder)
+	router.PUT("/orders/:id/delivery-time", testPolicy.Require("orders:write"), h.SetDeliveryTime)
+	router.PUT("/addresses/:id", testPolicy.Require("addresses:write"), h.UpdateDeliveryAddress)
+	router.DELETE("/addresses/:id", testPolicy.Require("addresses:write"), h.DeleteDeliveryAddress)
+	return router
+}
+
+func TestOrderWriteRoutes(t *testing.T) {
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+
+	tests := []struct {
+		name   string
+		user   string
+		role   string
+		method string
+		path   string
+		body   string
+		status int
+		write  string // what reached the backend, if anything
+	}{
+		{"own delivery time", "u1", "user", http.MethodPut, "/orders/o1/delivery-time", `{"delivery_time":"` + future + `"}`, http.StatusOK, "delivery-time o1"},
+		{"other's delivery time", "u2", "user", http.MethodPut, "/orders/o1/delivery-time", `{"delivery_time":"` + future + `"}`, http.StatusNotFound, ""},
+		{"missing order's delivery time", "u1", "user", http.MethodPut, "/orders/o9/delivery-time", `{"delivery_time":"` + future + `"}`, http.StatusNotFound, ""},
+		{"admin sets any delivery time", "u9", "admin", http.MethodPut, "/orders/o1/delivery-time", `{"delivery_time":"` + future + `"}`, http.StatusOK, "delivery-time o1"},
+		{"delivery time in the past", "u1", "user", http.MethodPut, "/orders/o1/delivery-time", `{"delivery_time":"` + past + `"}`, http.StatusBadRequest, ""},
+		{"delivery time missing", "u1", "user", http.MethodPut, "/orders/o1/delivery-time", `{}`, http.StatusBadRequest, ""},
+		{"update own address", "u1", "user", http.MethodPut, "/addresses/a1", `{}`, http.StatusOK, "update a1"},
+		{"update other's address", "u1", "user", http.MethodPut, "/addresses/a2", `{}`, http.StatusNotFound, ""},
+		{"update missing address", "u1", "user", http.MethodPut, "/addresses/a9", `{}`, http.StatusNotFound, ""},
+		{"admin updates any address", "u9", "admin", http.MethodPut, "/addresses/a2", `{}`, http.StatusOK, "update a2"},
+		{"delete own address", "u1", "user", http.MethodDelete, "/addresses/a1", "", http.StatusNoContent, "delete a1"},
+		{"delete other's address", "u1", "user", http.MethodDelete, "/addresses/a2", "", http.StatusNotFound, ""},
+		{"delete without permission", "u1", "viewer", http.MethodDelete, "/addresses/a1", "", http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &fakeOrderService{
+				orders: map[string]*pb.Order{"o1": {Id: "o1", UserId: "u1"}},
+				addresses: []*pb.DeliveryAddress{
+					{Id: "a1", UserId: "u1"},
+					{Id: "a2", UserId: "u2"},
+				},
+			}
+			w := serveAs(newOrderRouter(backend), tt.user, tt.role, tt.method, tt.path, tt.body)
+			if w.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if got := strings.Join(backend.writes, ", "); got != tt.write {
+				t.Errorf("backend writes %q, want %q", got, tt.write)
+			}
+		})
+	}
+}
+
+func TestCheckAddressOwnerPaging(t *testing.T) {
+	addresses := func(n int) []*pb.DeliveryAddress {
+		var addresses []*pb.DeliveryAddress
+		for i := 0; i < n; i++ {
+			addresses = append(addresses, &pb.DeliveryAddress{Id: fmt.Sprintf("a%d", i), UserId: "u1"})
+		}
+		return addresses
+	}
+
+	tests := []struct {
+		name       string
+		addresses  int
+		ignorePage bool
+		target     string
+		status     int
+		listCalls  int
+	}{
+		{"first page", 250, false, "a5", http.StatusNoContent, 1},
+		{"third page", 250, false, "a230", http.StatusNoContent, 3},
+		{"not on any page", 250, false, "a999", http.StatusNotFound, 3},
+		{"exactly one full page", addressPageSize, false, "a999", http.StatusNotFound, 2},
+		{"backend ignores the page", 250, true, "a230", http.StatusNotFound, addressMaxPages},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &fakeOrderService{addresses: addresses(tt.addresses), ignorePage: tt.ignorePage}
+			w := serveAs(newOrderRouter(backend), "u1", "user", http.MethodDelete, "/addresses/"+tt.target, "")
+			if w.Code != tt.status {
+				t.Errorf("status %d, want %d", w.Code, tt.status)
+			}
+			if backend.listCalls != tt.listCalls {
+				t.Errorf("listed %d pages, want %d", backend.listCalls, tt.listCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hsibAD/api-gateway/internal/auth"
+	"github.com/hsibAD/api-gateway/internal/problem"
+	"google.golang.org/grpc/codes"
+)
+
+// ownership hides other users' resources. A caller may see a resource when
+// they own it or hold the bypass permission (e.g. "orders:read-any", which
+// admins get through "*"). Anything else is answered with 404 so that
+// probing IDs does not reveal which ones exist.
+type ownership struct {
+	policy *auth.Policy
+}
+
+func (o ownership) allowed(c *gin.Context, ownerID, bypassPermission string) bool {
+	userID := c.GetString("user_id")
+	if ownerID != "" && ownerID == userID {
+		return true
+	}
+	return o.policy.Granted(c, bypassPermission)
+}
+
+// check writes the 404 response itself and returns false when access is denied.
+func (o ownership) check(c *gin.Context, ownerID, bypassPermission string) bool {
+	if o.allowed(c, ownerID, bypassPermission) {
+		return true
+	}
+	notFound(c)
+	return false
+}
+
+// notFound is the one 404 for both a resource the backend does not have and
+// one the caller may not see, so the body never tells the two apart.
+func notFound(c *gin.Context) {
+	problem.AbortWithFields(c, http.StatusNotFound, "not found", gin.H{"code": backendCodes[codes.NotFound].name})
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	orderpb "github.com/hsibAD/order-service/proto"
+	pb "github.com/hsibAD/payment-service/proto"
+)
+
+func TestOwnershipAllowed(t *testing.T) {
+	o := ownership{policy: testPolicy}
+	tests := []struct {
+		name   string
+		owner  string
+		user   string
+		role   string
+		scopes []string
+		want   bool
+	}{
+		{"owner", "u1", "u1", "user", nil, true},
+		{"another user", "u1", "u2", "user", nil, false},
+		{"no owner and no user", "", "", "user", nil, false},
+		{"admin bypass", "u1", "u9", "admin", nil, true},
+		{"scopes keep the bypass", "u1", "u9", "admin", []string{"orders:*"}, true},
+		{"scopes narrow the bypass away", "u1", "u9", "admin", []string{"orders:read"}, false},
+		{"owner with narrow scopes", "u1", "u1", "user", []string{"payments:read"}, true},
+		{"unauthenticated", "u1", "", "", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.user != "" {
+				c.Set("user_id", tt.user)
+			}
+			if tt.role != "" {
+				c.Set("role", tt.role)
+			}
+			if tt.scopes != nil {
+				c.Set("scopes", tt.scopes)
+			}
+
+			if got := o.check(c, tt.owner, "orders:read-any"); got != tt.want {
+				t.Errorf("check = %v, want %v", got, tt.want)
+			}
+			if !tt.want && w.Code != http.StatusNotFound {
+				t.Errorf("denied with status %d, want 404", w.Code)
+			}
+		})
+	}
+}
+
+func TestOwnershipReads(t *testing.T) {
+	orders := &fakeOrderService{orders: map[string]*orderpb.Order{
+		"o1": {Id: "o1", UserId: "u1"},
+		"o2": {Id: "o2", UserId: "u1"}, // no payments yet
+	}}
+	payments := &fakePaymentService{payments: map[string]*pb.Payment{
+		"p1": {Id: "p1", OrderId: "o1", UserId: "u1"},
+	}}
+	orderRouter := newOrderRouter(orders)
+	paymentRouter := newPaymentRouter(payments, orders)
+
+	tests := []struct {
+		name   string
+		router *gin.Engine
+		user   string
+		role   string
+		path   string
+		status int
+	}{
+		{"own order", orderRouter, "u1", "user", "/orders/o1", http.StatusOK},
+		{"other's order", orderRouter, "u2", "user", "/orders/o1", http.StatusNotFound},
+		{"missing order", orderRouter, "u1", "user", "/orders/o9", http.StatusNotFound},
+		{"admin reads any order", orderRouter, "u9", "admin", "/orders/o1", http.StatusOK},
+		{"own payment", paymentRouter, "u1", "user", "/payments/p1", http.StatusOK},
+		{"other's payment", paymentRouter, "u2", "user", "/payments/p1", http.StatusNotFound},
+		{"admin reads any payment", paymentRouter, "u9", "admin", "/payments/p1", http.StatusOK},
+		{"own order's payments", paymentRouter, "u1", "user", "/payments/order/o1", http.StatusOK},
+		{"other's order's payments", paymentRouter, "u2", "user", "/payments/order/o1", http.StatusNotFound},
+		{"own order without payments", paymentRouter, "u1", "user", "/payments/order/o2", http.StatusOK},
+		{"other's order without payments", paymentRouter, "u2", "user", "/payments/order/o2", http.StatusNotFound},
+		{"missing order's payments", paymentRouter, "u1", "user", "/payments/order/o9", http.StatusNotFound},
+		{"admin reads any order's payments", paymentRouter, "u9", "admin", "/payments/order/o2", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveAs(tt.router, tt.user, tt.role, http.MethodGet, tt.path, "")
+			if w.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
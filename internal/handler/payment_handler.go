@@ -5,17 +5,26 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/hsibAD/api-gateway/internal/auth"
+	"github.com/hsibAD/api-gateway/internal/problem"
 	"github.com/hsibAD/api-gateway/internal/proxy"
+	orderpb "github.com/hsibAD/order-service/proto"
 	pb "github.com/hsibAD/payment-service/proto"
 )
 
+// PaymentHandler needs the order service too, to check who owns the order
+// when listing its payments.
 type PaymentHandler struct {
 	paymentClient *proxy.PaymentServiceClient
+	orderClient   *proxy.OrderServiceClient
+	ownership     ownership
 }
 
-func NewPaymentHandler(paymentClient *proxy.PaymentServiceClient) *PaymentHandler {
+func NewPaymentHandler(paymentClient *proxy.PaymentServiceClient, orderClient *proxy.OrderServiceClient, policy *auth.Policy) *PaymentHandler {
 	return &PaymentHandler{
 		paymentClient: paymentClient,
+		orderClient:   orderClient,
+		ownership:     ownership{policy: policy},
 	}
 }
 
@@ -28,7 +37,7 @@ func (h *PaymentHandler) InitiatePayment(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		bindError(c, err)
 		return
 	}
 
@@ -44,7 +53,7 @@ func (h *PaymentHandler) InitiatePayment(c *gin.Context) {
 
 	payment, err := h.paymentClient.InitiatePayment(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		backendError(c, err)
 		return
 	}
 
@@ -62,7 +71,7 @@ func (h *PaymentHandler) ProcessCreditCardPayment(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		bindError(c, err)
 		return
 	}
 
@@ -79,7 +88,7 @@ func (h *PaymentHandler) ProcessCreditCardPayment(c *gin.Context) {
 
 	payment, err := h.paymentClient.ProcessCreditCardPayment(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		backendError(c, err)
 		return
 	}
 
@@ -93,7 +102,7 @@ func (h *PaymentHandler) InitiateMetaMaskPayment(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		bindError(c, err)
 		return
 	}
 
@@ -104,7 +113,7 @@ func (h *PaymentHandler) InitiateMetaMaskPayment(c *gin.Context) {
 
 	response, err := h.paymentClient.InitiateMetaMaskPayment(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		backendError(c, err)
 		return
 	}
 
@@ -118,7 +127,7 @@ func (h *PaymentHandler) ConfirmMetaMaskPayment(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		bindError(c, err)
 		return
 	}
 
@@ -129,7 +138,7 @@ func (h *PaymentHandler) ConfirmMetaMaskPayment(c *gin.Context) {
 
 	payment, err := h.paymentClient.ConfirmMetaMaskPayment(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		backendError(c, err)
 		return
 	}
 
@@ -144,28 +153,103 @@ func (h *PaymentHandler) GetPayment(c *gin.Context) {
 
 	payment, err := h.paymentClient.GetPayment(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		backendError(c, err)
+		return
+	}
+
+	if !h.ownership.check(c, payment.GetUserId(), "payments:read-any") {
 		return
 	}
 
 	c.JSON(http.StatusOK, payment)
 }
 
+// GetPaymentsByOrder checks the order itself rather than its payments, so
+// that an order without payments is as hidden from other users as any other.
 func (h *PaymentHandler) GetPaymentsByOrder(c *gin.Context) {
 	orderID := c.Param("order_id")
+
+	order, err := h.orderClient.GetOrder(c.Request.Context(), &orderpb.GetOrderRequest{OrderId: orderID})
+	if err != nil {
+		backendError(c, err)
+		return
+	}
+
+	if !h.ownership.check(c, order.GetUserId(), "payments:read-any") {
+		return
+	}
+
 	req := &pb.GetPaymentsByOrderRequest{
 		OrderId: orderID,
 	}
 
 	payments, err := h.paymentClient.GetPaymentsByOrder(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		backendError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, payments)
 }
 
+func (h *PaymentHandler) RetryPayment(c *gin.Context) {
+	paymentID := c.Param("id")
+
+	payment, err := h.paymentClient.GetPayment(c.Request.Context(), &pb.GetPaymentRequest{PaymentId: paymentID})
+	if err != nil {
+		backendError(c, err)
+		return
+	}
+
+	if !h.ownership.check(c, payment.GetUserId(), "payments:write-any") {
+		return
+	}
+
+	req := &pb.RetryPaymentRequest{
+		PaymentId: paymentID,
+	}
+
+	payment, err = h.paymentClient.RetryPayment(c.Request.Context(), req)
+	if err != nil {
+		backendError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, payment)
+}
+
+// UpdatePaymentStatus overrides a payment's status. Routed for admins only.
+func (h *PaymentHandler) UpdatePaymentStatus(c *gin.Context) {
+	paymentID := c.Param("id")
+	var request struct {
+		Status string `json:"status" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		bindError(c, err)
+		return
+	}
+
+	status, ok := pb.PaymentStatus_value[request.Status]
+	if !ok {
+		problem.Abort(c, http.StatusBadRequest, "unknown payment status: "+request.Status)
+		return
+	}
+
+	req := &pb.UpdatePaymentStatusRequest{
+		PaymentId: paymentID,
+		Status:    pb.PaymentStatus(status),
+	}
+
+	payment, err := h.paymentClient.UpdatePaymentStatus(c.Request.Context(), req)
+	if err != nil {
+		backendError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, payment)
+}
+
 func (h *PaymentHandler) GetPendingPayments(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
@@ -179,7 +263,7 @@ func (h *PaymentHandler) GetPendingPayments(c *gin.Context) {
 
 	payments, err := h.paymentClient.GetPendingPayments(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		backendError(c, err)
 		return
 	}
 
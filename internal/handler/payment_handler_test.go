@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hsibAD/api-gateway/internal/proxy"
+	pb "github.com/hsibAD/payment-service/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakePaymentService keeps payments in memory and records every write it
+// receives.
+type fakePaymentService struct {
+	pb.PaymentServiceClient
+
+	payments map[string]*pb.Payment
+	writes   []string
+}
+
+func (f *fakePaymentService) GetPayment(ctx context.Context, in *pb.GetPaymentRequest, opts ...grpc.CallOption) (*pb.Payment, error) {
+	payment, ok := f.payments[in.PaymentId]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "payment "+in.PaymentId+" not found")
+	}
+	return payment, nil
+}
+
+func (f *fakePaymentService) GetPaymentsByOrder(ctx context.Context, in *pb.GetPaymentsByOrderRequest, opts ...grpc.CallOption) (*pb.GetPaymentsByOrderResponse, error) {
+	response := &pb.GetPaymentsByOrderResponse{}
+	for _, payment := range f.payments {
+		if payment.OrderId == in.OrderId {
+			response.Payments = append(response.Payments, payment)
+		}
+	}
+	return response, nil
+}
+
+func (f *fakePaymentService) RetryPayment(ctx context.Context, in *pb.RetryPaymentRequest, opts ...grpc.CallOption) (*pb.Payment, error) {
+	f.writes = append(f.writes, "retry "+in.PaymentId)
+	return f.payments[in.PaymentId], nil
+}
+
+func (f *fakePaymentService) UpdatePaymentStatus(ctx context.Context, in *pb.UpdatePaymentStatusRequest, opts ...grpc.CallOption) (*pb.Payment, error) {
+	f.writes = append(f.writes, "status "+in.PaymentId)
+	return f.payments[in.PaymentId], nil
+}
+
+func newPaymentRouter(backend *fakePaymentService, orders *fakeOrderService) *gin.Engine {
+	h := NewPaymentHandler(proxy.NewPaymentServiceClientFrom(backend), proxy.NewOrderServiceClientFrom(orders), testPolicy)
+
+	router := gin.New()
+	router.Use(withIdentity)
+	router.GET("/payments/:id", testPolicy.Require("payments:read"), h.GetPayment)
+	router.GET("/payments/order/:order_id", testPolicy.Require("payments:read"), h.GetPaymentsByOrder)
+	router.POST("/payments/:id/retry", testPolicy.Require("payments:write"), h.RetryPayment)
+	router.PUT("/payments/:id/status", testPolicy.Require("payments:manage"), h.UpdatePaymentStatus)
+	return router
+}
+
+// knownPaymentStatus is any status name the payment service defines.
+func knownPaymentStatus(t *testing.T) string {
+	t.Helper()
+	for name := range pb.PaymentStatus_value {
+		return name
+	}
+	t.Fatal("the payment service defines no statuses")
+	return ""
+}
+
+func TestPaymentWriteRoutes(t *testing.T) {
+	known := `{"status":"` + knownPaymentStatus(t) + `"}`
+
+	tests := []struct {
+		name   string
+		user   string
+		role   string
+		method string
+		path   string
+		body   string
+		status int
+		write  string // what reached the backend, if anything
+	}{
+		{"retry own payment", "u1", "user", http.MethodPost, "/payments/p1/retry", "", http.StatusOK, "retry p1"},
+		{"retry other's payment", "u2", "user", http.MethodPost, "/payments/p1/retry", "", http.StatusNotFound, ""},
+		{"retry missing payment", "u1", "user", http.MethodPost, "/payments/p9/retry", "", http.StatusNotFound, ""},
+		{"admin retries any payment", "u9", "admin", http.MethodPost, "/payments/p1/retry", "", http.StatusOK, "retry p1"},
+		{"status by its owner", "u1", "user", http.MethodPut, "/payments/p1/status", known, http.StatusForbidden, ""},
+		{"status by an admin", "u9", "admin", http.MethodPut, "/payments/p1/status", known, http.StatusOK, "status p1"},
+		{"unknown status", "u9", "admin", http.MethodPut, "/payments/p1/status", `{"status":"REFUNDED_TWICE"}`, http.StatusBadRequest, ""},
+		{"status missing", "u9", "admin", http.MethodPut, "/payments/p1/status", `{}`, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &fakePaymentService{
+				payments: map[string]*pb.Payment{"p1": {Id: "p1", OrderId: "o1", UserId: "u1"}},
+			}
+			w := serveAs(newPaymentRouter(backend, &fakeOrderService{}), tt.user, tt.role, tt.method, tt.path, tt.body)
+			if w.Code != tt.status {
+				t.Errorf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if got := strings.Join(backend.writes, ", "); got != tt.write {
+				t.Errorf("backend writes %q, want %q", got, tt.write)
+			}
+		})
+	}
+}
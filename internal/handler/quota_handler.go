@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hsibAD/api-gateway/internal/middleware"
+	"github.com/hsibAD/api-gateway/internal/problem"
+)
+
+type QuotaHandler struct {
+	quotas *middleware.QuotaManager
+}
+
+func NewQuotaHandler(quotas *middleware.QuotaManager) *QuotaHandler {
+	return &QuotaHandler{
+		quotas: quotas,
+	}
+}
+
+// GetMyQuota reports the caller's own usage.
+func (h *QuotaHandler) GetMyQuota(c *gin.Context) {
+	usage, err := h.quotas.Usage(c.Request.Context(), middleware.QuotaSubject(c))
+	if err != nil {
+		problem.Abort(c, http.StatusInternalServerError, "failed to read quota")
+		return
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
+
+func (h *QuotaHandler) GetQuota(c *gin.Context) {
+	subject, ok := quotaSubjectParam(c)
+	if !ok {
+		return
+	}
+
+	usage, err := h.quotas.Usage(c.Request.Context(), subject)
+	if err != nil {
+		problem.Abort(c, http.StatusInternalServerError, "failed to read quota")
+		return
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
+
+// UpdateQuota assigns a plan and/or raises the subject's individual limits.
+func (h *QuotaHandler) UpdateQuota(c *gin.Context) {
+	subject, ok := quotaSubjectParam(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Plan             string `json:"plan"`
+		RequestsPerDay   *int64 `json:"requests_per_day" binding:"omitempty,min=0"`
+		RequestsPerMonth *int64 `json:"requests_per_month" binding:"omitempty,min=0"`
+		ClearOverrides   bool   `json:"clear_overrides"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		bindError(c, err)
+		return
+	}
+
+	if request.ClearOverrides {
+		if err := h.quotas.ClearOverrides(c.Request.Context(), subject); err != nil {
+			problem.Abort(c, http.StatusInternalServerError, "failed to update quota")
+			return
+		}
+	}
+
+	if err := h.quotas.Assign(c.Request.Context(), subject, request.Plan, request.RequestsPerDay, request.RequestsPerMonth); err != nil {
+		if errors.Is(err, middleware.ErrUnknownPlan) {
+			problem.Abort(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		problem.Abort(c, http.StatusInternalServerError, "failed to update quota")
+		return
+	}
+
+	h.GetQuota(c)
+}
+
+func (h *QuotaHandler) ResetQuota(c *gin.Context) {
+	subject, ok := quotaSubjectParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.quotas.Reset(c.Request.Context(), subject); err != nil {
+		problem.Abort(c, http.StatusInternalServerError, "failed to reset quota")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func quotaSubjectParam(c *gin.Context) (string, bool) {
+	kind := c.Param("kind")
+	if kind != "user" && kind != "api_key" {
+		problem.Abort(c, http.StatusBadRequest, "subject kind must be user or api_key")
+		return "", false
+	}
+	return kind + ":" + c.Param("id"), true
+}
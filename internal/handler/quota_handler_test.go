@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/hsibAD/api-gateway/internal/config"
+	"github.com/hsibAD/api-gateway/internal/middleware"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// serve sends a request with an optional JSON body through router.
+func serve(router *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, request)
+	return w
+}
+
+func newQuotaRouter(t *testing.T) (*miniredis.Miniredis, *gin.Engine) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	quotas, err := middleware.NewQuotaManager(client, &config.QuotaConfig{
+		DefaultPlan: "free",
+		Plans: map[string]config.QuotaPlan{
+			"free": {RequestsPerDay: 10, RequestsPerMonth: 100},
+			"pro":  {RequestsPerDay: 1000, RequestsPerMonth: 10000},
+		},
+	}, time.Second, 5, time.Minute)
+	if err != nil {
+		t.Fatalf("NewQuotaManager: %v", err)
+	}
+	h := NewQuotaHandler(quotas)
+
+	router := gin.New()
+	router.GET("/quota", func(c *gin.Context) { c.Set("user_id", "1") }, quotas.Middleware(), h.GetMyQuota)
+	router.GET("/quotas/:kind/:id", h.GetQuota)
+	router.PUT("/quotas/:kind/:id", h.UpdateQuota)
+	router.POST("/quotas/:kind/:id/reset", h.ResetQuota)
+	return server, router
+}
+
+func decodeUsage(t *testing.T, w *httptest.ResponseRecorder) middleware.QuotaUsage {
+	t.Helper()
+	var usage middleware.QuotaUsage
+	if err := json.Unmarshal(w.Body.Bytes(), &usage); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+	return usage
+}
+
+func TestGetMyQuota(t *testing.T) {
+	_, router := newQuotaRouter(t)
+
+	serve(router, http.MethodGet, "/quota", "")
+	w := serve(router, http.MethodGet, "/quota", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", w.Code)
+	}
+	// The request reading the quota counts too.
+	usage := decodeUsage(t, w)
+	if usage.Subject != "user:1" || usage.Plan != "free" || usage.Day.Used != 2 || usage.Day.Remaining != 8 {
+		t.Errorf("usage = %+v, want 2 of the free plan's 10 used by user:1", usage)
+	}
+}
+
+func TestQuotaAdminEndpoints(t *testing.T) {
+	_, router := newQuotaRouter(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		check  func(t *testing.T, usage middleware.QuotaUsage)
+	}{
+		{
+			name: "get", method: http.MethodGet, path: "/quotas/api_key/k1", status: http.StatusOK,
+			check: func(t *testing.T, usage middleware.QuotaUsage) {
+				if usage.Subject != "api_key:k1" || usage.Plan != "free" {
+					t.Errorf("usage = %+v, want api_key:k1 on free", usage)
+				}
+			},
+		},
+		{name: "unknown kind", method: http.MethodGet, path: "/quotas/team/1", status: http.StatusBadRequest},
+		{
+			name: "assign plan", method: http.MethodPut, path: "/quotas/user/2", body: `{"plan":"pro"}`, status: http.StatusOK,
+			check: func(t *testing.T, usage middleware.QuotaUsage) {
+				if usage.Plan != "pro" || usage.Day.Limit != 1000 {
+					t.Errorf("usage = %+v, want the pro plan", usage)
+				}
+			},
+		},
+		{
+			name: "override", method: http.MethodPut, path: "/quotas/user/2", body: `{"requests_per_day":5}`, status: http.StatusOK,
+			check: func(t *testing.T, usage middleware.QuotaUsage) {
+				if usage.Plan != "pro" || usage.Day.Limit != 5 || usage.Month.Limit != 10000 {
+					t.Errorf("usage = %+v, want pro with 5 a day", usage)
+				}
+			},
+		},
+		{
+			name: "clear overrides", method: http.MethodPut, path: "/quotas/user/2", body: `{"clear_overrides":true}`, status: http.StatusOK,
+			check: func(t *testing.T, usage middleware.QuotaUsage) {
+				if usage.Day.Limit != 1000 {
+					t.Errorf("usage = %+v, want the pro plan's daily limit", usage)
+				}
+			},
+		},
+		{name: "unknown plan", method: http.MethodPut, path: "/quotas/user/2", body: `{"plan":"platinum"}`, status: http.StatusBadRequest},
+		{name: "negative limit", method: http.MethodPut, path: "/quotas/user/2", body: `{"requests_per_day":-1}`, status: http.StatusBadRequest},
+		{name: "reset", method: http.MethodPost, path: "/quotas/user/1/reset", status: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serve(router, tt.method, tt.path, tt.body)
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.check != nil {
+				tt.check(t, decodeUsage(t, w))
+			}
+		})
+	}
+}
+
+func TestResetQuota(t *testing.T) {
+	_, router := newQuotaRouter(t)
+
+	for i := 0; i < 3; i++ {
+		serve(router, http.MethodGet, "/quota", "")
+	}
+	if w := serve(router, http.MethodPost, "/quotas/user/1/reset", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("reset status %d, want 204", w.Code)
+	}
+	if usage := decodeUsage(t, serve(router, http.MethodGet, "/quotas/user/1", "")); usage.Day.Used != 0 || usage.Month.Used != 0 {
+		t.Errorf("usage after reset = %+v, want none", usage)
+	}
+}
+
+func TestQuotaEndpointsWithoutRedis(t *testing.T) {
+	server, router := newQuotaRouter(t)
+	server.SetError("ERR unavailable")
+
+	if w := serve(router, http.MethodGet, "/quotas/user/1", ""); w.Code != http.StatusInternalServerError {
+		t.Errorf("get status %d, want 500", w.Code)
+	}
+	if w := serve(router, http.MethodPut, "/quotas/user/1", `{"plan":"pro"}`); w.Code != http.StatusInternalServerError {
+		t.Errorf("update status %d, want 500", w.Code)
+	}
+	if w := serve(router, http.MethodPost, "/quotas/user/1/reset", ""); w.Code != http.StatusInternalServerError {
+		t.Errorf("reset status %d, want 500", w.Code)
+	}
+}
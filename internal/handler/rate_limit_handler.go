@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hsibAD/api-gateway/internal/middleware"
+	"github.com/hsibAD/api-gateway/internal/problem"
+)
+
+type RateLimitHandler struct {
+	rateLimiter *middleware.RateLimiter
+}
+
+func NewRateLimitHandler(rateLimiter *middleware.RateLimiter) *RateLimitHandler {
+	return &RateLimitHandler{
+		rateLimiter: rateLimiter,
+	}
+}
+
+// GetCounters shows the counters for ?key= (e.g. "user=42" or
+// "ip=203.0.113.7"), optionally narrowed to one ?policy=.
+func (h *RateLimitHandler) GetCounters(c *gin.Context) {
+	key, ok := counterKeyParam(c)
+	if !ok {
+		return
+	}
+
+	counters, err := h.rateLimiter.Counters(c.Request.Context(), key, c.Query("policy"))
+	if err != nil {
+		respondRateLimitError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"counters": counters})
+}
+
+func (h *RateLimitHandler) ClearCounters(c *gin.Context) {
+	key, ok := counterKeyParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.rateLimiter.ClearCounters(c.Request.Context(), key, c.Query("policy")); err != nil {
+		respondRateLimitError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func counterKeyParam(c *gin.Context) (string, bool) {
+	key := c.Query("key")
+	if key == "" {
+		problem.Abort(c, http.StatusBadRequest, "key query parameter is required")
+		return "", false
+	}
+	return key, true
+}
+
+func respondRateLimitError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, middleware.ErrUnknownPolicy):
+		problem.Abort(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, middleware.ErrRateLimiterUnavailable):
+		problem.Abort(c, http.StatusServiceUnavailable, "rate limiting unavailable")
+	default:
+		problem.Abort(c, http.StatusInternalServerError, "failed to access rate limit counters")
+	}
+}
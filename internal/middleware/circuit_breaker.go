@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"sync"
+	"time"
+)
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuitBreaker stops calling a failing dependency for a cooldown after
+// threshold consecutive failures, then lets a single probe through to find
+// out whether it has recovered.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	state     circuitState
+	failures  int
+	openedAt  time.Time
+	threshold int
+	cooldown  time.Duration
+	onChange  func(open bool)
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration, onChange func(open bool)) *circuitBreaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		onChange:  onChange,
+	}
+}
+
+// Allow reports whether the dependency may be called now.
+func (cb *circuitBreaker) Allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case circuitOpen:
+		if time.Since(cb.openedAt) < cb.cooldown {
+			return false
+		}
+		cb.state = circuitHalfOpen
+		return true
+	case circuitHalfOpen:
+		// A probe is already in flight.
+		return false
+	default:
+		return true
+	}
+}
+
+func (cb *circuitBreaker) Success() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	wasOpen := cb.state != circuitClosed
+	cb.state = circuitClosed
+	cb.failures = 0
+	if wasOpen {
+		cb.onChange(false)
+	}
+}
+
+func (cb *circuitBreaker) Failure() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures++
+	switch {
+	case cb.state == circuitHalfOpen:
+		cb.state = circuitOpen
+		cb.openedAt = time.Now()
+	case cb.state == circuitClosed && cb.failures >= cb.threshold:
+		cb.state = circuitOpen
+		cb.openedAt = time.Now()
+		cb.onChange(true)
+	}
+}
+
+// Abort ends a probe that finished without telling anything about the
+// dependency's health, so the next call probes again.
+func (cb *circuitBreaker) Abort() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == circuitHalfOpen {
+		cb.state = circuitOpen
+		cb.openedAt = time.Now().Add(-cb.cooldown)
+	}
+}
+
+func (cb *circuitBreaker) Open() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state != circuitClosed
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestBreaker records every state change reported by the breaker.
+func newTestBreaker(threshold int) (*circuitBreaker, *[]bool) {
+	changes := &[]bool{}
+	cb := newCircuitBreaker(threshold, time.Minute, func(open bool) {
+		*changes = append(*changes, open)
+	})
+	return cb, changes
+}
+
+// endCooldown makes the breaker's cooldown run out now.
+func endCooldown(cb *circuitBreaker) {
+	cb.mu.Lock()
+	cb.openedAt = time.Now().Add(-cb.cooldown)
+	cb.mu.Unlock()
+}
+
+func TestCircuitBreakerOpensAfterThreshold(t *testing.T) {
+	cb, changes := newTestBreaker(3)
+
+	cb.Failure()
+	cb.Failure()
+	cb.Success() // consecutive failures only
+	cb.Failure()
+	cb.Failure()
+	if cb.Open() || !cb.Allow() {
+		t.Fatalf("breaker open after 2 consecutive failures, want closed")
+	}
+
+	cb.Failure()
+	if !cb.Open() || cb.Allow() {
+		t.Fatalf("breaker closed after 3 consecutive failures, want open")
+	}
+	if len(*changes) != 1 || !(*changes)[0] {
+		t.Errorf("state changes = %v, want [true]", *changes)
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	tests := []struct {
+		name     string
+		probe    func(*circuitBreaker)
+		open     bool
+		allowed  bool // whether the next call goes through
+		reported []bool
+	}{
+		{"probe succeeds", (*circuitBreaker).Success, false, true, []bool{true, false}},
+		{"probe fails", (*circuitBreaker).Failure, true, false, []bool{true}},
+		{"probe aborted", (*circuitBreaker).Abort, true, true, []bool{true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cb, changes := newTestBreaker(1)
+			cb.Failure()
+			if cb.Allow() {
+				t.Fatalf("breaker allowed a call during its cooldown")
+			}
+
+			endCooldown(cb)
+			if !cb.Allow() {
+				t.Fatalf("breaker refused the probe after its cooldown")
+			}
+			if cb.Allow() {
+				t.Fatalf("breaker allowed a second call while the probe is in flight")
+			}
+
+			tt.probe(cb)
+			if cb.Open() != tt.open {
+				t.Errorf("open = %v, want %v", cb.Open(), tt.open)
+			}
+			if cb.Allow() != tt.allowed {
+				t.Errorf("next call allowed = %v, want %v", !tt.allowed, tt.allowed)
+			}
+			if len(*changes) != len(tt.reported) {
+				t.Fatalf("state changes = %v, want %v", *changes, tt.reported)
+			}
+			for i := range tt.reported {
+				if (*changes)[i] != tt.reported[i] {
+					t.Errorf("state changes = %v, want %v", *changes, tt.reported)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerMinimumThreshold(t *testing.T) {
+	cb, _ := newTestBreaker(0)
+	cb.Failure()
+	if !cb.Open() {
+		t.Errorf("breaker with threshold 0 stayed closed after a failure")
+	}
+}
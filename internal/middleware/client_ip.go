@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClientIPResolver works out the address of the client behind any trusted
+// reverse proxies. Forwarding headers are only believed when the peer is a
+// trusted proxy, and are read right to left, so a client cannot pick its
+// own address by sending them.
+type ClientIPResolver struct {
+	trusted []netip.Prefix
+}
+
+func NewClientIPResolver(trustedProxies []string) (*ClientIPResolver, error) {
+	r := &ClientIPResolver{}
+	for _, cidr := range trustedProxies {
+		prefix, err := parsePrefix(cidr)
+		if err != nil {
+			return nil, err
+		}
+		r.trusted = append(r.trusted, prefix)
+	}
+	return r, nil
+}
+
+// Trusted reports whether addr belongs to a trusted proxy.
+func (r *ClientIPResolver) Trusted(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range r.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware stores the resolved address as "client_ip" (and the direct
+// peer as "peer_ip") and rewrites the request's RemoteAddr to it, so
+// c.ClientIP(), the access log and everything downstream see the client.
+// It must be the first middleware; the engine must not trust forwarding
+// headers itself.
+func (r *ClientIPResolver) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		host, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+		if err != nil {
+			host = c.Request.RemoteAddr
+		}
+		peer, err := netip.ParseAddr(host)
+		if err != nil {
+			c.Next()
+			return
+		}
+		peer = peer.Unmap()
+
+		client := r.resolve(peer, c.Request)
+		c.Set("peer_ip", peer.String())
+		c.Set("client_ip", client.String())
+		if client != peer {
+			c.Request.RemoteAddr = net.JoinHostPort(client.String(), "0")
+		}
+
+		c.Next()
+	}
+}
+
+func (r *ClientIPResolver) resolve(peer netip.Addr, req *http.Request) netip.Addr {
+	if !r.Trusted(peer) {
+		return peer
+	}
+
+	// Forwarded supersedes X-Forwarded-For when a proxy sends it.
+	hops := forwardedFor(req.Header.Values("Forwarded"))
+	if len(hops) == 0 {
+		for _, value := range req.Header.Values("X-Forwarded-For") {
+			hops = append(hops, strings.Split(value, ",")...)
+		}
+	}
+
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := parseHop(hops[i])
+		if !ok {
+			// Obfuscated or garbled: the hop that sent it is as far as
+			// we can see.
+			break
+		}
+		client = addr
+		if !r.Trusted(addr) {
+			break
+		}
+	}
+	return client
+}
+
+// forwardedFor extracts the for= parameters of an RFC 7239 Forwarded
+// header, in order.
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					hops = append(hops, strings.Trim(val, `"`))
+				}
+			}
+		}
+	}
+	return hops
+}
+
+// parseHop accepts "192.0.2.1", "192.0.2.1:4711", "2001:db8::1" and
+// "[2001:db8::1]:4711".
+func parseHop(hop string) (netip.Addr, bool) {
+	hop = strings.TrimSpace(hop)
+	if addr, err := netip.ParseAddr(hop); err == nil {
+		return addr.Unmap(), true
+	}
+	if addrPort, err := netip.ParseAddrPort(hop); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	if addr, err := netip.ParseAddr(strings.Trim(hop, "[]")); err == nil {
+		return addr.Unmap(), true
+	}
+	return netip.Addr{}, false
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestClientIPResolve(t *testing.T) {
+	r, err := NewClientIPResolver([]string{"10.0.0.0/8", "2001:db8:ffff::/48"})
+	if err != nil {
+		t.Fatalf("NewClientIPResolver: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		peer    string
+		headers map[string]string
+		want    string
+	}{
+		{"untrusted peer ignores headers", "203.0.113.1", map[string]string{"X-Forwarded-For": "198.51.100.7"}, "203.0.113.1"},
+		{"trusted peer without headers", "10.0.0.1", nil, "10.0.0.1"},
+		{"X-Forwarded-For", "10.0.0.1", map[string]string{"X-Forwarded-For": "198.51.100.7"}, "198.51.100.7"},
+		{"through several trusted proxies", "10.0.0.1", map[string]string{"X-Forwarded-For": "198.51.100.7, 10.0.0.3, 10.0.0.2"}, "198.51.100.7"},
+		{"spoofed leftmost entry", "10.0.0.1", map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.7"}, "198.51.100.7"},
+		{"all hops trusted", "10.0.0.1", map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"Forwarded wins over X-Forwarded-For", "10.0.0.1", map[string]string{
+			"Forwarded":       `for=192.0.2.60;proto=https;by=10.0.0.1`,
+			"X-Forwarded-For": "198.51.100.7",
+		}, "192.0.2.60"},
+		{"Forwarded IPv6 with port", "10.0.0.1", map[string]string{"Forwarded": `for="[2001:db8:cafe::17]:4711"`}, "2001:db8:cafe::17"},
+		{"Forwarded through a trusted IPv6 proxy", "10.0.0.1", map[string]string{"Forwarded": `for=192.0.2.60, for="[2001:db8:ffff::1]"`}, "192.0.2.60"},
+		{"obfuscated hop stops the walk", "10.0.0.1", map[string]string{"Forwarded": `for=192.0.2.60, for=_hidden`}, "10.0.0.1"},
+		{"garbage in X-Forwarded-For", "10.0.0.1", map[string]string{"X-Forwarded-For": "198.51.100.7, not-an-ip"}, "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			if got := r.resolve(netip.MustParseAddr(tt.peer), req); got != netip.MustParseAddr(tt.want) {
+				t.Errorf("resolve = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIPMiddleware(t *testing.T) {
+	r, err := NewClientIPResolver([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("NewClientIPResolver: %v", err)
+	}
+
+	router := gin.New()
+	router.ForwardedByClientIP = false
+	router.Use(r.Middleware())
+	router.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, "%s %s %s", c.GetString("client_ip"), c.GetString("peer_ip"), c.ClientIP())
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "[::ffff:10.0.0.1]:40000"
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if got, want := w.Body.String(), "198.51.100.7 10.0.0.1 198.51.100.7"; got != want {
+		t.Errorf("client, peer, ClientIP = %q, want %q", got, want)
+	}
+}
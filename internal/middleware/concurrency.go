@@ -0,0 +1,199 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hsibAD/api-gateway/internal/config"
+	"github.com/hsibAD/api-gateway/internal/problem"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type Priority int
+
+const (
+	PriorityNormal Priority = iota
+	// PriorityCritical requests may use the capacity reserved by
+	// CriticalReserve, so they are the last to be shed.
+	PriorityCritical
+)
+
+func (p Priority) String() string {
+	if p == PriorityCritical {
+		return "critical"
+	}
+	return "normal"
+}
+
+var (
+	concurrencyInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gateway_concurrency_in_flight",
+		Help: "Requests currently admitted, by scope (group or backend) and name.",
+	}, []string{"scope", "name"})
+	concurrencyLimit = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gateway_concurrency_limit",
+		Help: "Current in-flight limit, by scope (group or backend) and name.",
+	}, []string{"scope", "name"})
+	concurrencyShed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_load_shed_total",
+		Help: "Requests rejected with 503 because a group or backend was saturated.",
+	}, []string{"scope", "name", "priority"})
+)
+
+// gate counts the requests in flight against a limit.
+type gate struct {
+	scope string
+	name  string
+	limit limitAlgorithm
+
+	mu       sync.Mutex
+	inFlight int
+}
+
+func (g *gate) acquire(priority Priority, reserve float64) bool {
+	limit := g.limit.Limit()
+	concurrencyLimit.WithLabelValues(g.scope, g.name).Set(float64(limit))
+
+	allowed := limit
+	if priority != PriorityCritical {
+		allowed = int(float64(limit) * (1 - reserve))
+		if allowed < 1 {
+			allowed = 1
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.inFlight >= allowed {
+		return false
+	}
+	g.inFlight++
+	concurrencyInFlight.WithLabelValues(g.scope, g.name).Set(float64(g.inFlight))
+	return true
+}
+
+func (g *gate) release() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.inFlight--
+	concurrencyInFlight.WithLabelValues(g.scope, g.name).Set(float64(g.inFlight))
+}
+
+func (g *gate) current() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.inFlight
+}
+
+// ConcurrencyLimiter sheds load once too many requests are in flight for a
+// route group or a backend. Group limits are fixed; backend limits follow
+// the latency of gRPC calls to that backend unless the mode is static.
+type ConcurrencyLimiter struct {
+	config   *config.ConcurrencyConfig
+	groups   map[string]*gate
+	backends map[string]*gate
+	critical map[string]bool
+}
+
+func NewConcurrencyLimiter(cfg *config.ConcurrencyConfig) (*ConcurrencyLimiter, error) {
+	if cfg.CriticalReserve < 0 || cfg.CriticalReserve >= 1 {
+		return nil, fmt.Errorf("critical reserve must be in [0, 1), got %v", cfg.CriticalReserve)
+	}
+
+	l := &ConcurrencyLimiter{
+		config:   cfg,
+		groups:   make(map[string]*gate, len(cfg.Groups)),
+		backends: make(map[string]*gate, len(cfg.Backends)),
+		critical: make(map[string]bool, len(cfg.CriticalRoutes)),
+	}
+
+	for name, limit := range cfg.Groups {
+		l.groups[name] = &gate{scope: "group", name: name, limit: staticLimit(limit)}
+	}
+	for name, limit := range cfg.Backends {
+		algorithm, err := newLimitAlgorithm(cfg.Mode, limit, cfg.MinLimit, cfg.TargetLatency)
+		if err != nil {
+			return nil, err
+		}
+		l.backends[name] = &gate{scope: "backend", name: name, limit: algorithm}
+	}
+	for _, route := range cfg.CriticalRoutes {
+		l.critical[route] = true
+	}
+
+	return l, nil
+}
+
+// Middleware admits a request into the route group and the backend serving
+// it, or rejects it with 503. Either name may be empty to skip that limit.
+func (l *ConcurrencyLimiter) Middleware(group, backend string) gin.HandlerFunc {
+	var gates []*gate
+	if g, ok := l.groups[group]; ok {
+		gates = append(gates, g)
+	}
+	if g, ok := l.backends[backend]; ok {
+		gates = append(gates, g)
+	}
+
+	return func(c *gin.Context) {
+		priority := l.priority(c)
+
+		for i, g := range gates {
+			if !g.acquire(priority, l.config.CriticalReserve) {
+				for _, held := range gates[:i] {
+					held.release()
+				}
+				concurrencyShed.WithLabelValues(g.scope, g.name, priority.String()).Inc()
+				c.Header("Retry-After", strconv.Itoa(ceilSeconds(l.config.RetryAfter)))
+				problem.AbortWithFields(c, http.StatusServiceUnavailable, "service overloaded, retry later", gin.H{
+					"retry_after": ceilSeconds(l.config.RetryAfter),
+				})
+				return
+			}
+		}
+		defer func() {
+			for _, g := range gates {
+				g.release()
+			}
+		}()
+
+		c.Next()
+	}
+}
+
+func (l *ConcurrencyLimiter) priority(c *gin.Context) Priority {
+	if l.critical[c.Request.Method+" "+c.FullPath()] {
+		return PriorityCritical
+	}
+	return PriorityNormal
+}
+
+// UnaryClientInterceptor feeds the latency of calls to backend into its
+// adaptive limit.
+func (l *ConcurrencyLimiter) UnaryClientInterceptor(backend string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		g, ok := l.backends[backend]
+		if !ok {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		code := status.Code(err)
+		dropped := code == codes.DeadlineExceeded || code == codes.Unavailable || code == codes.ResourceExhausted
+		// The caller giving up says nothing about the backend.
+		if code != codes.Canceled {
+			g.limit.Observe(time.Since(start), g.current(), dropped)
+		}
+		return err
+	}
+}
@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	ConcurrencyModeStatic   = "static"
+	ConcurrencyModeAIMD     = "aimd"
+	ConcurrencyModeGradient = "gradient"
+)
+
+// limitAlgorithm adjusts a concurrency limit from observed backend calls.
+// dropped marks a call that timed out or found the backend unavailable.
+type limitAlgorithm interface {
+	Limit() int
+	Observe(rtt time.Duration, inFlight int, dropped bool)
+}
+
+func newLimitAlgorithm(mode string, initial, min int, target time.Duration) (limitAlgorithm, error) {
+	switch mode {
+	case ConcurrencyModeStatic:
+		return staticLimit(initial), nil
+	case ConcurrencyModeAIMD:
+		return newAIMDLimit(initial, min, target), nil
+	case ConcurrencyModeGradient:
+		return newGradientLimit(initial, min), nil
+	default:
+		return nil, fmt.Errorf("unknown concurrency mode %q", mode)
+	}
+}
+
+type staticLimit int
+
+func (l staticLimit) Limit() int { return int(l) }
+
+func (l staticLimit) Observe(time.Duration, int, bool) {}
+
+// aimdLimit grows the limit by one while calls stay under the target
+// latency and cuts it by a tenth when they don't. Slow calls finishing
+// together count as one signal, so it backs off at most once per target.
+type aimdLimit struct {
+	mu           sync.Mutex
+	limit        float64
+	min          float64
+	max          float64
+	target       time.Duration
+	lastDecrease time.Time
+}
+
+func newAIMDLimit(max, min int, target time.Duration) *aimdLimit {
+	return &aimdLimit{
+		limit:  float64(max),
+		min:    float64(min),
+		max:    float64(max),
+		target: target,
+	}
+}
+
+func (l *aimdLimit) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+func (l *aimdLimit) Observe(rtt time.Duration, inFlight int, dropped bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch {
+	case dropped || rtt > l.target:
+		if time.Since(l.lastDecrease) >= l.target {
+			l.limit = math.Max(l.min, l.limit*0.9)
+			l.lastDecrease = time.Now()
+		}
+	case float64(inFlight)*2 >= l.limit:
+		// Only grow when the limit is actually being used.
+		l.limit = math.Min(l.max, l.limit+1)
+	}
+}
+
+// gradientLimit compares short-term latency with the long-term average and
+// shrinks the limit in proportion as calls get slower, leaving room for a
+// small queue (the Gradient2 algorithm).
+type gradientLimit struct {
+	mu       sync.Mutex
+	limit    float64
+	min      float64
+	max      float64
+	shortRTT float64
+	longRTT  float64
+}
+
+func newGradientLimit(max, min int) *gradientLimit {
+	return &gradientLimit{
+		limit: float64(max),
+		min:   float64(min),
+		max:   float64(max),
+	}
+}
+
+func (l *gradientLimit) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+func (l *gradientLimit) Observe(rtt time.Duration, inFlight int, dropped bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sample := float64(rtt)
+	if l.longRTT == 0 {
+		l.shortRTT, l.longRTT = sample, sample
+		return
+	}
+	l.shortRTT = l.shortRTT*0.9 + sample*0.1
+	l.longRTT = l.longRTT*0.99 + sample*0.01
+
+	// Let the baseline recover after a sustained slowdown ends.
+	if l.longRTT/l.shortRTT > 2 {
+		l.longRTT *= 0.95
+	}
+
+	// An idle backend tells us nothing about how much more it can take.
+	if !dropped && float64(inFlight)*2 < l.limit {
+		return
+	}
+
+	gradient := math.Max(0.5, math.Min(1, l.longRTT/l.shortRTT))
+	if dropped {
+		gradient = 0.5
+	}
+	next := l.limit*gradient + math.Sqrt(l.limit)
+	l.limit = math.Max(l.min, math.Min(l.max, l.limit*0.8+next*0.2))
+}
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAIMDLimit(t *testing.T) {
+	const target = 100 * time.Millisecond
+	fast, slow := 10*time.Millisecond, 200*time.Millisecond
+
+	l := newAIMDLimit(10, 2, target)
+	steps := []struct {
+		name     string
+		rtt      time.Duration
+		inFlight int
+		dropped  bool
+		waited   bool // a target's worth of time has passed since the last decrease
+		want     int
+	}{
+		{"fast at the maximum", fast, 5, false, true, 10},
+		{"slow", slow, 5, false, true, 9},
+		{"slow in the same target", slow, 5, false, false, 9},
+		{"slow after a target", slow, 5, false, true, 8},
+		{"fast but idle", fast, 1, false, true, 8},
+		{"fast and busy", fast, 5, false, true, 9},
+		{"dropped", fast, 5, true, true, 8},
+		{"dropped in the same target", fast, 5, true, false, 8},
+	}
+	for _, step := range steps {
+		if step.waited {
+			l.lastDecrease = l.lastDecrease.Add(-target)
+		}
+		l.Observe(step.rtt, step.inFlight, step.dropped)
+		if got := l.Limit(); got != step.want {
+			t.Errorf("%s: limit %d, want %d", step.name, got, step.want)
+		}
+	}
+
+	for i := 0; i < 50; i++ {
+		l.lastDecrease = time.Time{}
+		l.Observe(0, 0, true)
+	}
+	if got := l.Limit(); got != 2 {
+		t.Errorf("after repeated drops: limit %d, want the minimum 2", got)
+	}
+}
+
+func TestGradientLimit(t *testing.T) {
+	fast, slow := 10*time.Millisecond, 40*time.Millisecond
+
+	l := newGradientLimit(100, 10)
+	steps := []struct {
+		name     string
+		rtt      time.Duration
+		inFlight int
+		dropped  bool
+		want     int
+	}{
+		{"first call sets the baseline", fast, 60, false, 100},
+		{"steady", fast, 60, false, 100},
+		{"slow", slow, 60, false, 97},
+		{"slow", slow, 60, false, 93},
+		{"slow", slow, 60, false, 87},
+		{"slow but idle", slow, 10, false, 87},
+		{"dropped", slow, 60, true, 81},
+	}
+	for _, step := range steps {
+		l.Observe(step.rtt, step.inFlight, step.dropped)
+		if got := l.Limit(); got != step.want {
+			t.Errorf("%s: limit %d, want %d", step.name, got, step.want)
+		}
+	}
+
+	for i := 0; i < 50; i++ {
+		l.Observe(slow, 60, true)
+	}
+	if got := l.Limit(); got != 10 {
+		t.Fatalf("after repeated drops: limit %d, want the minimum 10", got)
+	}
+
+	// Once calls are fast again the limit climbs back to the maximum.
+	for i := 0; i < 200 && l.Limit() < 100; i++ {
+		l.Observe(fast, l.Limit(), false)
+	}
+	if got := l.Limit(); got != 100 {
+		t.Errorf("after recovery: limit %d, want the maximum 100", got)
+	}
+}
+
+func TestNewLimitAlgorithm(t *testing.T) {
+	tests := []struct {
+		mode    string
+		wantErr bool
+	}{
+		{ConcurrencyModeStatic, false},
+		{ConcurrencyModeAIMD, false},
+		{ConcurrencyModeGradient, false},
+		{"vegas", true},
+	}
+	for _, tt := range tests {
+		algorithm, err := newLimitAlgorithm(tt.mode, 8, 2, time.Second)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("newLimitAlgorithm(%q) error = %v, wantErr %v", tt.mode, err, tt.wantErr)
+			continue
+		}
+		if err == nil && algorithm.Limit() != 8 {
+			t.Errorf("newLimitAlgorithm(%q) starts at %d, want 8", tt.mode, algorithm.Limit())
+		}
+	}
+
+	static := staticLimit(8)
+	static.Observe(time.Hour, 8, true)
+	if static.Limit() != 8 {
+		t.Errorf("static limit moved to %d", static.Limit())
+	}
+}
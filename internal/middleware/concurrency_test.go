@@ -0,0 +1,235 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hsibAD/api-gateway/internal/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const confirmRoute = "/api/v1/payments/metamask/confirm"
+
+// blockingRouter serves the payment routes behind limiter and holds every
+// admitted request until release is closed.
+type blockingRouter struct {
+	router  *gin.Engine
+	entered chan struct{}
+	release chan struct{}
+	wg      sync.WaitGroup
+}
+
+func newBlockingRouter(t *testing.T, limiter *ConcurrencyLimiter) *blockingRouter {
+	t.Helper()
+	br := &blockingRouter{entered: make(chan struct{}, 100), release: make(chan struct{})}
+	t.Cleanup(func() {
+		br.open()
+		br.wg.Wait()
+	})
+
+	hold := func(c *gin.Context) {
+		br.entered <- struct{}{}
+		<-br.release
+		c.Status(http.StatusOK)
+	}
+	br.router = gin.New()
+	payments := br.router.Group("/api/v1/payments", limiter.Middleware("payments", "payment-service"))
+	payments.GET("", hold)
+	payments.POST("/metamask/confirm", hold)
+	return br
+}
+
+func (br *blockingRouter) open() {
+	select {
+	case <-br.release:
+	default:
+		close(br.release)
+	}
+}
+
+// send makes a request and returns its status if it was rejected, or 0 once
+// it has been admitted and is being held.
+func (br *blockingRouter) send(t *testing.T, method, path string) int {
+	t.Helper()
+	rejected := make(chan int, 1)
+	br.wg.Add(1)
+	go func() {
+		defer br.wg.Done()
+		w := httptest.NewRecorder()
+		br.router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		if w.Code != http.StatusOK {
+			rejected <- w.Code
+		}
+	}()
+
+	select {
+	case <-br.entered:
+		return 0
+	case code := <-rejected:
+		return code
+	case <-time.After(time.Second):
+		t.Fatalf("%s %s neither admitted nor rejected", method, path)
+		return 0
+	}
+}
+
+func newTestConcurrencyLimiter(t *testing.T, group, backend int, reserve float64) *ConcurrencyLimiter {
+	t.Helper()
+	l, err := NewConcurrencyLimiter(&config.ConcurrencyConfig{
+		Mode:            ConcurrencyModeStatic,
+		Groups:          map[string]int{"payments": group},
+		Backends:        map[string]int{"payment-service": backend},
+		CriticalReserve: reserve,
+		CriticalRoutes:  []string{"POST " + confirmRoute},
+		RetryAfter:      1500 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewConcurrencyLimiter: %v", err)
+	}
+	return l
+}
+
+func TestGateCriticalReserve(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		reserve  float64
+		normal   int // requests admitted before normal ones are refused
+		critical int // further critical requests admitted after that
+	}{
+		{"no reserve", 10, 0, 10, 0},
+		{"a fifth reserved", 10, 0.2, 8, 2},
+		{"reserve rounds the normal share down", 7, 0.2, 5, 2},
+		{"normal requests always get one slot", 1, 0.9, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &gate{scope: "group", name: tt.name, limit: staticLimit(tt.limit)}
+			for i := 0; i < tt.normal; i++ {
+				if !g.acquire(PriorityNormal, tt.reserve) {
+					t.Fatalf("normal request %d refused, want %d admitted", i, tt.normal)
+				}
+			}
+			if g.acquire(PriorityNormal, tt.reserve) {
+				t.Fatalf("normal request admitted into the reserve")
+			}
+			for i := 0; i < tt.critical; i++ {
+				if !g.acquire(PriorityCritical, tt.reserve) {
+					t.Fatalf("critical request %d refused, want %d admitted from the reserve", i, tt.critical)
+				}
+			}
+			if g.acquire(PriorityCritical, tt.reserve) {
+				t.Errorf("critical request admitted over the limit")
+			}
+
+			g.release()
+			if g.acquire(PriorityNormal, tt.reserve) && tt.critical > 0 {
+				t.Errorf("normal request admitted while critical requests hold the reserve")
+			}
+		})
+	}
+}
+
+// Payment confirmations are the last requests to be shed: once the group is
+// too busy for anything else they are still admitted, up to the full limit.
+func TestPaymentConfirmationShedLast(t *testing.T) {
+	l := newTestConcurrencyLimiter(t, 5, 100, 0.4)
+	br := newBlockingRouter(t, l)
+
+	for i := 0; i < 3; i++ {
+		if code := br.send(t, http.MethodGet, "/api/v1/payments"); code != 0 {
+			t.Fatalf("listing %d: status %d, want admitted", i, code)
+		}
+	}
+	if code := br.send(t, http.MethodGet, "/api/v1/payments"); code != http.StatusServiceUnavailable {
+		t.Fatalf("listing over the normal share: status %d, want 503", code)
+	}
+	for i := 0; i < 2; i++ {
+		if code := br.send(t, http.MethodPost, confirmRoute); code != 0 {
+			t.Fatalf("confirmation %d: status %d, want admitted from the reserve", i, code)
+		}
+	}
+	if code := br.send(t, http.MethodPost, confirmRoute); code != http.StatusServiceUnavailable {
+		t.Errorf("confirmation over the full limit: status %d, want 503", code)
+	}
+}
+
+func TestConcurrencyShedResponse(t *testing.T) {
+	l := newTestConcurrencyLimiter(t, 1, 100, 0)
+	br := newBlockingRouter(t, l)
+	br.send(t, http.MethodGet, "/api/v1/payments")
+
+	w := httptest.NewRecorder()
+	br.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/payments", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status %d, want 503", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want the configured 1.5s rounded up to 2", got)
+	}
+}
+
+func TestConcurrencyReleasesGates(t *testing.T) {
+	l := newTestConcurrencyLimiter(t, 10, 2, 0)
+	br := newBlockingRouter(t, l)
+
+	br.send(t, http.MethodGet, "/api/v1/payments")
+	br.send(t, http.MethodGet, "/api/v1/payments")
+	// The backend is full; the group slot taken on the way is given back.
+	if code := br.send(t, http.MethodGet, "/api/v1/payments"); code != http.StatusServiceUnavailable {
+		t.Fatalf("status %d, want 503 from the backend limit", code)
+	}
+	if got := l.groups["payments"].current(); got != 2 {
+		t.Errorf("group in flight = %d after a backend rejection, want 2", got)
+	}
+
+	br.open()
+	br.wg.Wait()
+	if group, backend := l.groups["payments"].current(), l.backends["payment-service"].current(); group != 0 || backend != 0 {
+		t.Errorf("in flight after all requests finished: group %d, backend %d, want 0", group, backend)
+	}
+}
+
+func TestConcurrencyInterceptorFeedsLimit(t *testing.T) {
+	l, err := NewConcurrencyLimiter(&config.ConcurrencyConfig{
+		Mode:          ConcurrencyModeAIMD,
+		Backends:      map[string]int{"payment-service": 10},
+		MinLimit:      1,
+		TargetLatency: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewConcurrencyLimiter: %v", err)
+	}
+	interceptor := l.UnaryClientInterceptor("payment-service")
+	call := func(code codes.Code) {
+		invoker := func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+			return status.Error(code, "")
+		}
+		interceptor(context.Background(), "/Payments/Get", nil, nil, nil, invoker)
+	}
+
+	// A caller cancelling is not held against the backend.
+	call(codes.Canceled)
+	if got := l.backends["payment-service"].limit.Limit(); got != 10 {
+		t.Errorf("limit after a cancelled call = %d, want 10", got)
+	}
+	call(codes.Unavailable)
+	if got := l.backends["payment-service"].limit.Limit(); got != 9 {
+		t.Errorf("limit after an unavailable backend = %d, want 9", got)
+	}
+}
+
+func TestNewConcurrencyLimiterReserve(t *testing.T) {
+	for _, reserve := range []float64{-0.1, 1} {
+		if _, err := NewConcurrencyLimiter(&config.ConcurrencyConfig{CriticalReserve: reserve}); err == nil {
+			t.Errorf("critical reserve %v accepted", reserve)
+		}
+	}
+}
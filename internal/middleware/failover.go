@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var ErrRateLimiterUnavailable = errors.New("rate limiter unavailable")
+
+const (
+	FailureModeFallback = "fallback"
+	FailureModeOpen     = "open"
+	FailureModeClosed   = "closed"
+)
+
+var (
+	rateLimiterDegraded = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gateway_rate_limiter_degraded",
+		Help: "1 while the rate limiter cannot reach Redis and runs in its failure mode.",
+	})
+	rateLimiterRedisErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "gateway_rate_limiter_redis_errors_total",
+		Help: "Rate limit checks against Redis that failed or timed out.",
+	})
+	rateLimiterDegradedDecisions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_rate_limiter_degraded_decisions_total",
+		Help: "Rate limit decisions made without Redis, by failure mode.",
+	}, []string{"mode"})
+)
+
+// FailoverAlgorithm guards a Redis-backed algorithm with a timeout and a
+// circuit breaker. While Redis is unhealthy requests are, depending on the
+// mode, checked against an in-process limiter, allowed, or rejected.
+type FailoverAlgorithm struct {
+	primary  Algorithm
+	fallback Algorithm
+	mode     string
+	timeout  time.Duration
+	breaker  *circuitBreaker
+}
+
+func NewFailoverAlgorithm(primary Algorithm, mode string, timeout time.Duration, threshold int, cooldown time.Duration) (*FailoverAlgorithm, error) {
+	switch mode {
+	case FailureModeFallback, FailureModeOpen, FailureModeClosed:
+	default:
+		return nil, fmt.Errorf("unknown rate limit failure mode %q", mode)
+	}
+
+	return &FailoverAlgorithm{
+		primary:  primary,
+		fallback: NewLocalTokenBucket(),
+		mode:     mode,
+		timeout:  timeout,
+		breaker: newCircuitBreaker(threshold, cooldown, func(open bool) {
+			if open {
+				rateLimiterDegraded.Set(1)
+				fmt.Printf("Rate limiter lost Redis, continuing in %q mode\n", mode)
+				return
+			}
+			rateLimiterDegraded.Set(0)
+			fmt.Println("Rate limiter reconnected to Redis")
+		}),
+	}, nil
+}
+
+func (f *FailoverAlgorithm) Allow(ctx context.Context, key string, limit Limit) (*Result, error) {
+	if f.breaker.Allow() {
+		callCtx, cancel := context.WithTimeout(ctx, f.timeout)
+		result, err := f.primary.Allow(callCtx, key, limit)
+		cancel()
+		if err == nil {
+			f.breaker.Success()
+			return result, nil
+		}
+		// A client hanging up is not Redis' fault.
+		if ctx.Err() != nil {
+			f.breaker.Abort()
+			return nil, ctx.Err()
+		}
+		f.breaker.Failure()
+		rateLimiterRedisErrors.Inc()
+	}
+
+	rateLimiterDegradedDecisions.WithLabelValues(f.mode).Inc()
+	switch f.mode {
+	case FailureModeFallback:
+		return f.fallback.Allow(ctx, key, limit)
+	case FailureModeOpen:
+		return &Result{Allowed: true, Limit: limit.Rate, Remaining: limit.Rate, Window: limit.Period}, nil
+	default:
+		return nil, ErrRateLimiterUnavailable
+	}
+}
+
+// Peek reads the counters currently in charge: the in-process ones while
+// Redis is down in fallback mode, Redis otherwise.
+func (f *FailoverAlgorithm) Peek(ctx context.Context, key string, limit Limit) (*Result, error) {
+	if f.breaker.Open() {
+		if f.mode == FailureModeFallback {
+			return f.fallback.Peek(ctx, key, limit)
+		}
+		return nil, ErrRateLimiterUnavailable
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+	return f.primary.Peek(callCtx, key, limit)
+}
+
+// Reset clears the key both in Redis and in the fallback limiter.
+func (f *FailoverAlgorithm) Reset(ctx context.Context, key string) error {
+	f.fallback.Reset(ctx, key)
+
+	callCtx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+	return f.primary.Reset(callCtx, key)
+}
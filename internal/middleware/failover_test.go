@@ -0,0 +1,170 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/hsibAD/api-gateway/internal/config"
+)
+
+// hangingAlgorithm never answers before the caller gives up.
+type hangingAlgorithm struct{}
+
+func (hangingAlgorithm) Allow(ctx context.Context, key string, limit Limit) (*Result, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (hangingAlgorithm) Peek(ctx context.Context, key string, limit Limit) (*Result, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (hangingAlgorithm) Reset(ctx context.Context, key string) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func newTestFailover(t *testing.T, mode string) (*miniredis.Miniredis, *FailoverAlgorithm) {
+	t.Helper()
+	server, client := newTestMiniredis(t)
+	f, err := NewFailoverAlgorithm(NewTokenBucket(client), mode, time.Second, 2, time.Minute)
+	if err != nil {
+		t.Fatalf("NewFailoverAlgorithm: %v", err)
+	}
+	return server, f
+}
+
+func TestFailoverModes(t *testing.T) {
+	limit := Limit{Rate: 60, Period: time.Hour, Burst: 2}
+	tests := []struct {
+		mode    string
+		allowed []bool // outcomes of consecutive requests while Redis is down
+		err     error
+	}{
+		{FailureModeFallback, []bool{true, true, false, false}, nil},
+		{FailureModeOpen, []bool{true, true, true, true}, nil},
+		{FailureModeClosed, nil, ErrRateLimiterUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			server, f := newTestFailover(t, tt.mode)
+			server.SetError("LOADING Redis is loading the dataset in memory")
+
+			for i := 0; i < 4; i++ {
+				result, err := f.Allow(context.Background(), "key", limit)
+				if tt.err != nil {
+					if !errors.Is(err, tt.err) {
+						t.Fatalf("request %d: error = %v, want %v", i, err, tt.err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("request %d: Allow: %v", i, err)
+				}
+				if result.Allowed != tt.allowed[i] {
+					t.Errorf("request %d: allowed = %v, want %v", i, result.Allowed, tt.allowed[i])
+				}
+			}
+			if !f.breaker.Open() {
+				t.Errorf("breaker closed after failures past the threshold")
+			}
+		})
+	}
+}
+
+func TestFailoverRecovers(t *testing.T) {
+	server, f := newTestFailover(t, FailureModeFallback)
+	limit := Limit{Rate: 60, Period: time.Hour, Burst: 5}
+	ctx := context.Background()
+
+	server.SetError("ERR unavailable")
+	for i := 0; i < 3; i++ {
+		f.Allow(ctx, "key", limit)
+	}
+	// Peek follows the limiter in charge: the fallback one for now.
+	if result, err := f.Peek(ctx, "key", limit); err != nil || result == nil || result.Remaining != 2 {
+		t.Fatalf("Peek while degraded = %+v, %v, want the fallback's 2 remaining", result, err)
+	}
+
+	server.SetError("")
+	endCooldown(f.breaker)
+	result, err := f.Allow(ctx, "key", limit)
+	if err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	if f.breaker.Open() {
+		t.Fatalf("breaker still open after a successful probe")
+	}
+	// Redis never saw the degraded requests.
+	if result.Remaining != 4 {
+		t.Errorf("remaining after recovery = %d, want Redis' 4", result.Remaining)
+	}
+}
+
+func TestFailoverTimeout(t *testing.T) {
+	f, err := NewFailoverAlgorithm(hangingAlgorithm{}, FailureModeOpen, 10*time.Millisecond, 1, time.Minute)
+	if err != nil {
+		t.Fatalf("NewFailoverAlgorithm: %v", err)
+	}
+	limit := Limit{Rate: 60, Period: time.Minute}
+
+	// A client that gives up is not held against Redis.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := f.Allow(ctx, "key", limit); !errors.Is(err, context.Canceled) {
+		t.Errorf("Allow with a cancelled request error = %v, want context.Canceled", err)
+	}
+	if f.breaker.Open() {
+		t.Fatalf("a cancelled request opened the breaker")
+	}
+
+	start := time.Now()
+	result, err := f.Allow(context.Background(), "key", limit)
+	if err != nil || !result.Allowed {
+		t.Fatalf("Allow after a timeout = %+v, %v, want allowed in open mode", result, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Allow took %s, want about the 10ms timeout", elapsed)
+	}
+	if !f.breaker.Open() {
+		t.Errorf("a timeout did not count as a failure")
+	}
+}
+
+func TestRateLimiterWithoutRedis(t *testing.T) {
+	tests := []struct {
+		mode string
+		want int
+	}{
+		{FailureModeFallback, http.StatusOK},
+		{FailureModeOpen, http.StatusOK},
+		{FailureModeClosed, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			server, f := newTestFailover(t, tt.mode)
+			server.Close()
+
+			rl, err := NewRateLimiter(f, &config.RateLimitConfig{RequestsPerMinute: 60, BurstSize: 10})
+			if err != nil {
+				t.Fatalf("NewRateLimiter: %v", err)
+			}
+			router := gin.New()
+			router.Use(rl.Middleware())
+			router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
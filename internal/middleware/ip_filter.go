@@ -0,0 +1,280 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/hsibAD/api-gateway/internal/config"
+	"github.com/hsibAD/api-gateway/internal/problem"
+)
+
+var (
+	ErrInvalidIPRule  = errors.New("invalid IP rule")
+	ErrIPRuleNotFound = errors.New("IP rule not found")
+)
+
+const (
+	IPRuleAllow = "allow"
+	IPRuleDeny  = "deny"
+
+	ipRulesKey = "ip_rules"
+
+	ipRuleRefreshTimeout = 5 * time.Second
+)
+
+// IPRule allows or denies a CIDR range, everywhere or only under Group, a
+// path prefix such as "/api/v1/payments". Allowed ranges skip rate limiting.
+type IPRule struct {
+	ID        string    `json:"id"`
+	CIDR      string    `json:"cidr"`
+	Action    string    `json:"action"`
+	Group     string    `json:"group,omitempty"`
+	Comment   string    `json:"comment,omitempty"`
+	CreatedBy string    `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+
+	prefix netip.Prefix
+}
+
+func (r *IPRule) compile() error {
+	if r.Action != IPRuleAllow && r.Action != IPRuleDeny {
+		return fmt.Errorf("%w: action must be %q or %q", ErrInvalidIPRule, IPRuleAllow, IPRuleDeny)
+	}
+	if r.Group != "" && !strings.HasPrefix(r.Group, "/") {
+		return fmt.Errorf("%w: group must be a path prefix", ErrInvalidIPRule)
+	}
+
+	prefix, err := parsePrefix(r.CIDR)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidIPRule, err)
+	}
+	r.prefix = prefix
+	r.CIDR = prefix.String()
+	return nil
+}
+
+// parsePrefix accepts a CIDR range or a single address.
+func parsePrefix(cidr string) (netip.Prefix, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		addr, addrErr := netip.ParseAddr(cidr)
+		if addrErr != nil {
+			return netip.Prefix{}, fmt.Errorf("%q is not an IP address or CIDR range", cidr)
+		}
+		prefix = netip.PrefixFrom(addr, addr.BitLen())
+	}
+	return prefix.Masked(), nil
+}
+
+func (r *IPRule) matches(addr netip.Addr, path string) bool {
+	if !r.prefix.Contains(addr) {
+		return false
+	}
+	group := strings.TrimSuffix(r.Group, "/")
+	return group == "" || path == group || strings.HasPrefix(path, group+"/")
+}
+
+// IPFilter blocks denied ranges and marks allowed ones before any other
+// middleware runs. Rules from the config are fixed; rules added through
+// the admin API live in Redis and are picked up by every instance within
+// RefreshInterval. If Redis is unreachable the last known rules stay in
+// force.
+type IPFilter struct {
+	redis  *redis.Client
+	config *config.IPFilterConfig
+	static []*IPRule
+
+	mu      sync.RWMutex
+	rules   []*IPRule
+	dynamic []*IPRule
+
+	// refreshMu orders refreshes, so one that read Redis before an Add
+	// cannot store its older rules after the Add's own refresh.
+	refreshMu sync.Mutex
+	stop      chan struct{}
+}
+
+// NewIPFilter loads the rules stored in Redis before returning, so they are
+// in force from the first request. prev is the filter being replaced on a
+// config reload, or nil; its Redis rules stay in force if Redis cannot be
+// reached now.
+func NewIPFilter(client *redis.Client, filterConfig *config.IPFilterConfig, prev *IPFilter) (*IPFilter, error) {
+	f := &IPFilter{
+		redis:  client,
+		config: filterConfig,
+		stop:   make(chan struct{}),
+	}
+
+	for action, ranges := range map[string][]string{IPRuleAllow: filterConfig.Allow, IPRuleDeny: filterConfig.Deny} {
+		for _, cidr := range ranges {
+			rule := &IPRule{ID: "config", CIDR: cidr, Action: action}
+			if err := rule.compile(); err != nil {
+				return nil, err
+			}
+			f.static = append(f.static, rule)
+		}
+	}
+	f.rules = f.static
+	if prev != nil {
+		prev.mu.RLock()
+		f.dynamic = prev.dynamic
+		prev.mu.RUnlock()
+		f.rules = append(append([]*IPRule(nil), f.static...), f.dynamic...)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ipRuleRefreshTimeout)
+	defer cancel()
+	if err := f.Refresh(ctx); err != nil {
+		fmt.Printf("Failed to load IP rules: %v\n", err)
+	}
+
+	go f.refreshLoop()
+	return f, nil
+}
+
+// Middleware rejects denied clients with 403 and flags allowlisted ones so
+// the rate limiter lets them through. When several rules match, the most
+// specific range wins, and deny wins a tie.
+func (f *IPFilter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		addr, err := netip.ParseAddr(c.ClientIP())
+		if err != nil {
+			c.Next()
+			return
+		}
+		addr = addr.Unmap()
+
+		f.mu.RLock()
+		var match *IPRule
+		for _, rule := range f.rules {
+			if !rule.matches(addr, c.Request.URL.Path) {
+				continue
+			}
+			if match == nil || rule.prefix.Bits() > match.prefix.Bits() ||
+				(rule.prefix.Bits() == match.prefix.Bits() && rule.Action == IPRuleDeny) {
+				match = rule
+			}
+		}
+		f.mu.RUnlock()
+
+		if match != nil {
+			switch match.Action {
+			case IPRuleDeny:
+				problem.Abort(c, http.StatusForbidden, "access denied")
+				return
+			case IPRuleAllow:
+				c.Set("ip_allowlisted", true)
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// Rules returns every rule in force, config rules first.
+func (f *IPFilter) Rules() []*IPRule {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return append([]*IPRule(nil), f.rules...)
+}
+
+func (f *IPFilter) Add(ctx context.Context, rule *IPRule) error {
+	if err := rule.compile(); err != nil {
+		return err
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	rule.ID = hex.EncodeToString(id)
+	rule.CreatedAt = time.Now().UTC()
+
+	data, err := json.Marshal(rule)
+	if err != nil {
+		return err
+	}
+	if err := f.redis.HSet(ctx, ipRulesKey, rule.ID, data).Err(); err != nil {
+		return err
+	}
+	return f.Refresh(ctx)
+}
+
+func (f *IPFilter) Remove(ctx context.Context, id string) error {
+	removed, err := f.redis.HDel(ctx, ipRulesKey, id).Result()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return ErrIPRuleNotFound
+	}
+	return f.Refresh(ctx)
+}
+
+// Refresh reloads the rules stored in Redis.
+func (f *IPFilter) Refresh(ctx context.Context) error {
+	f.refreshMu.Lock()
+	defer f.refreshMu.Unlock()
+
+	entries, err := f.redis.HGetAll(ctx, ipRulesKey).Result()
+	if err != nil {
+		return err
+	}
+
+	dynamic := make([]*IPRule, 0, len(entries))
+	for id, data := range entries {
+		rule := &IPRule{}
+		if err := json.Unmarshal([]byte(data), rule); err != nil {
+			fmt.Printf("Skipping malformed IP rule %s: %v\n", id, err)
+			continue
+		}
+		if err := rule.compile(); err != nil {
+			fmt.Printf("Skipping invalid IP rule %s: %v\n", id, err)
+			continue
+		}
+		dynamic = append(dynamic, rule)
+	}
+	sort.Slice(dynamic, func(i, j int) bool { return dynamic[i].CreatedAt.Before(dynamic[j].CreatedAt) })
+
+	rules := append(append([]*IPRule(nil), f.static...), dynamic...)
+	f.mu.Lock()
+	f.rules = rules
+	f.dynamic = dynamic
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *IPFilter) Close() {
+	close(f.stop)
+}
+
+func (f *IPFilter) refreshLoop() {
+	ticker := time.NewTicker(f.config.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-f.stop:
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), ipRuleRefreshTimeout)
+		if err := f.Refresh(ctx); err != nil {
+			fmt.Printf("Failed to refresh IP rules: %v\n", err)
+		}
+		cancel()
+	}
+}
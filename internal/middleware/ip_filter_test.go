@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/hsibAD/api-gateway/internal/config"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func newTestRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	_, client := newTestMiniredis(t)
+	return client
+}
+
+// newTestMiniredis also returns the server, for tests that set its clock
+// or make it fail.
+func newTestMiniredis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return server, client
+}
+
+func newTestIPFilter(t *testing.T, allow, deny []string) *IPFilter {
+	t.Helper()
+	f, err := NewIPFilter(newTestRedis(t), &config.IPFilterConfig{Allow: allow, Deny: deny, RefreshInterval: time.Hour}, nil)
+	if err != nil {
+		t.Fatalf("NewIPFilter: %v", err)
+	}
+	t.Cleanup(f.Close)
+	return f
+}
+
+// filterOutcome runs a request from remoteIP through f and reports
+// "denied", "allowed" (allowlisted) or "passed".
+func filterOutcome(t *testing.T, f *IPFilter, remoteIP, path string) string {
+	t.Helper()
+	router := gin.New()
+	router.Use(f.Middleware())
+	router.NoRoute(func(c *gin.Context) {
+		if c.GetBool("ip_allowlisted") {
+			c.String(http.StatusOK, "allowed")
+			return
+		}
+		c.String(http.StatusOK, "passed")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = net.JoinHostPort(remoteIP, "40000")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code == http.StatusForbidden {
+		return "denied"
+	}
+	return w.Body.String()
+}
+
+func TestIPFilterMostSpecificRuleWins(t *testing.T) {
+	f := newTestIPFilter(t,
+		[]string{"10.1.0.0/16", "192.168.0.7"},
+		[]string{"10.0.0.0/8", "192.168.0.0/24", "10.1.2.0/24"},
+	)
+
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"10.9.0.1", "denied"},        // only the /8
+		{"10.1.9.9", "allowed"},       // the /16 allow beats the /8 deny
+		{"10.1.2.3", "denied"},        // the /24 deny beats the /16 allow
+		{"192.168.0.7", "allowed"},    // a single address beats its /24
+		{"192.168.0.8", "denied"},     // the rest of that /24
+		{"203.0.113.5", "passed"},     // no rule
+		{"::ffff:10.9.0.1", "denied"}, // IPv4-mapped IPv6 is matched as IPv4
+	}
+	for _, tt := range tests {
+		if got := filterOutcome(t, f, tt.ip, "/api/v1/orders"); got != tt.want {
+			t.Errorf("%s: %s, want %s", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestIPFilterDenyWinsTie(t *testing.T) {
+	f := newTestIPFilter(t, []string{"10.3.0.0/16"}, []string{"10.3.0.0/16"})
+	if got := filterOutcome(t, f, "10.3.4.5", "/"); got != "denied" {
+		t.Errorf("equally specific allow and deny: %s, want denied", got)
+	}
+}
+
+func TestIPFilterGroups(t *testing.T) {
+	f := newTestIPFilter(t, nil, nil)
+	ctx := context.Background()
+	if err := f.Add(ctx, &IPRule{CIDR: "172.16.0.0/12", Action: IPRuleDeny, Group: "/api/v1/payments"}); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/api/v1/payments", "denied"},
+		{"/api/v1/payments/42", "denied"},
+		{"/api/v1/paymentsx", "passed"},
+		{"/api/v1/orders", "passed"},
+	}
+	for _, tt := range tests {
+		if got := filterOutcome(t, f, "172.16.1.1", tt.path); got != tt.want {
+			t.Errorf("%s: %s, want %s", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestIPFilterDynamicRules(t *testing.T) {
+	f := newTestIPFilter(t, nil, nil)
+	ctx := context.Background()
+
+	rule := &IPRule{CIDR: "198.51.100.0/24", Action: IPRuleDeny, Comment: "abuse"}
+	if err := f.Add(ctx, rule); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if rule.ID == "" {
+		t.Fatalf("Add did not assign an ID")
+	}
+	if got := filterOutcome(t, f, "198.51.100.20", "/"); got != "denied" {
+		t.Errorf("after Add: %s, want denied", got)
+	}
+
+	if err := f.Remove(ctx, rule.ID); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if got := filterOutcome(t, f, "198.51.100.20", "/"); got != "passed" {
+		t.Errorf("after Remove: %s, want passed", got)
+	}
+	if err := f.Remove(ctx, rule.ID); !errors.Is(err, ErrIPRuleNotFound) {
+		t.Errorf("second Remove error = %v, want ErrIPRuleNotFound", err)
+	}
+
+	for _, invalid := range []*IPRule{
+		{CIDR: "not-an-ip", Action: IPRuleDeny},
+		{CIDR: "10.0.0.0/8", Action: "block"},
+		{CIDR: "10.0.0.0/8", Action: IPRuleDeny, Group: "payments"},
+	} {
+		if err := f.Add(ctx, invalid); !errors.Is(err, ErrInvalidIPRule) {
+			t.Errorf("Add(%+v) error = %v, want ErrInvalidIPRule", invalid, err)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// localSweepInterval is how often idle buckets are dropped from memory.
+const localSweepInterval = time.Minute
+
+// LocalTokenBucket is an in-process token bucket. Each gateway instance
+// counts on its own, so it is only used as a stand-in while Redis is
+// unreachable.
+type LocalTokenBucket struct {
+	mu        sync.Mutex
+	buckets   map[string]*localBucket
+	lastSweep time.Time
+}
+
+type localBucket struct {
+	tokens   float64
+	updated  time.Time
+	capacity float64
+	rate     float64
+}
+
+func NewLocalTokenBucket() *LocalTokenBucket {
+	return &LocalTokenBucket{
+		buckets:   make(map[string]*localBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (lb *LocalTokenBucket) Allow(ctx context.Context, key string, limit Limit) (*Result, error) {
+	burst := limit.Burst
+	if burst < 1 {
+		burst = 1
+	}
+	rate := float64(limit.Rate) / limit.Period.Seconds()
+	now := time.Now()
+
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	if now.Sub(lb.lastSweep) >= localSweepInterval {
+		lb.sweep(now)
+	}
+
+	bucket, ok := lb.buckets[key]
+	if !ok {
+		bucket = &localBucket{tokens: float64(burst), updated: now}
+		lb.buckets[key] = bucket
+	}
+	bucket.capacity, bucket.rate = float64(burst), rate
+	bucket.tokens = math.Min(bucket.capacity, bucket.tokens+now.Sub(bucket.updated).Seconds()*rate)
+	bucket.updated = now
+
+	result := &Result{Limit: burst}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - bucket.tokens) / rate)
+	}
+	result.Remaining = int(bucket.tokens)
+	result.ResetAfter = secondsToDuration((bucket.capacity - bucket.tokens) / rate)
+	result.Window = secondsToDuration(bucket.capacity / rate)
+	return result, nil
+}
+
+func (lb *LocalTokenBucket) Peek(ctx context.Context, key string, limit Limit) (*Result, error) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	bucket, ok := lb.buckets[key]
+	if !ok {
+		return nil, nil
+	}
+	tokens := math.Min(bucket.capacity, bucket.tokens+time.Since(bucket.updated).Seconds()*bucket.rate)
+
+	result := &Result{
+		Allowed:    tokens >= 1,
+		Limit:      int(bucket.capacity),
+		Remaining:  int(tokens),
+		ResetAfter: secondsToDuration((bucket.capacity - tokens) / bucket.rate),
+		Window:     secondsToDuration(bucket.capacity / bucket.rate),
+	}
+	if !result.Allowed {
+		result.RetryAfter = secondsToDuration((1 - tokens) / bucket.rate)
+	}
+	return result, nil
+}
+
+func (lb *LocalTokenBucket) Reset(ctx context.Context, key string) error {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	delete(lb.buckets, key)
+	return nil
+}
+
+// sweep drops buckets that have refilled completely; recreating them later
+// gives the same answer. Must be called with mu held.
+func (lb *LocalTokenBucket) sweep(now time.Time) {
+	for key, bucket := range lb.buckets {
+		if bucket.tokens+now.Sub(bucket.updated).Seconds()*bucket.rate >= bucket.capacity {
+			delete(lb.buckets, key)
+		}
+	}
+	lb.lastSweep = now
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// ageBucket moves a bucket's last update back by d, as if d had passed.
+func ageBucket(lb *LocalTokenBucket, key string, d time.Duration) {
+	lb.mu.Lock()
+	lb.buckets[key].updated = lb.buckets[key].updated.Add(-d)
+	lb.mu.Unlock()
+}
+
+func TestLocalTokenBucket(t *testing.T) {
+	ctx := context.Background()
+	lb := NewLocalTokenBucket()
+	limit := Limit{Rate: 60, Period: time.Hour, Burst: 3}
+
+	allow := func(key string) *Result {
+		t.Helper()
+		result, err := lb.Allow(ctx, key, limit)
+		if err != nil {
+			t.Fatalf("Allow: %v", err)
+		}
+		return result
+	}
+
+	for want := 2; want >= 0; want-- {
+		if result := allow("a"); !result.Allowed || result.Remaining != want {
+			t.Fatalf("allowed %v with %d remaining, want allowed with %d", result.Allowed, result.Remaining, want)
+		}
+	}
+	result := allow("a")
+	if result.Allowed {
+		t.Fatalf("request over the burst allowed")
+	}
+	if result.RetryAfter <= 59*time.Second || result.RetryAfter > time.Minute {
+		t.Errorf("retry after %s, want about a minute", result.RetryAfter)
+	}
+	if result := allow("b"); !result.Allowed {
+		t.Errorf("another key shares the bucket")
+	}
+
+	// One token back per minute, never more than the burst.
+	ageBucket(lb, "a", time.Minute)
+	if result := allow("a"); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("after a minute: allowed %v with %d remaining, want one token", result.Allowed, result.Remaining)
+	}
+	ageBucket(lb, "a", 24*time.Hour)
+	if result := allow("a"); result.Remaining != 2 {
+		t.Errorf("after a day: %d remaining, want the burst minus one", result.Remaining)
+	}
+}
+
+func TestLocalTokenBucketPeekResetSweep(t *testing.T) {
+	ctx := context.Background()
+	lb := NewLocalTokenBucket()
+	limit := Limit{Rate: 60, Period: time.Hour, Burst: 3}
+
+	if result, _ := lb.Peek(ctx, "a", limit); result != nil {
+		t.Fatalf("Peek of an unused key = %+v, want nil", result)
+	}
+	lb.Allow(ctx, "a", limit)
+	lb.Allow(ctx, "b", limit)
+	if result, _ := lb.Peek(ctx, "a", limit); result == nil || result.Remaining != 2 {
+		t.Errorf("Peek = %+v, want 2 remaining", result)
+	}
+
+	lb.Reset(ctx, "a")
+	if result, _ := lb.Peek(ctx, "a", limit); result != nil {
+		t.Errorf("Peek after Reset = %+v, want nil", result)
+	}
+
+	// Full buckets are dropped on the next sweep; others are kept.
+	ageBucket(lb, "b", time.Hour)
+	lb.Allow(ctx, "c", limit)
+	lb.mu.Lock()
+	lb.lastSweep = time.Now().Add(-localSweepInterval)
+	lb.mu.Unlock()
+	lb.Allow(ctx, "d", limit)
+
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	if _, ok := lb.buckets["b"]; ok {
+		t.Errorf("sweep kept a full bucket")
+	}
+	if _, ok := lb.buckets["c"]; !ok {
+		t.Errorf("sweep dropped a bucket still refilling")
+	}
+}
@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Label values are kept to bounded sets: routes are templates such as
+// /api/v1/orders/:id, methods outside the standard ones are folded into
+// OTHER, and requests that match no route share one series.
+const (
+	routeUnmatched = "unmatched"
+	methodOther    = "OTHER"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_http_requests_total",
+		Help: "HTTP requests handled, by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gateway_http_request_duration_seconds",
+		Help:    "Time to handle an HTTP request, by method and route template.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+	httpRequestsInFlight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gateway_http_requests_in_flight",
+		Help: "HTTP requests currently being handled, by method and route template.",
+	}, []string{"method", "route"})
+	httpResponseSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gateway_http_response_size_bytes",
+		Help:    "Size of HTTP response bodies, by method and route template.",
+		Buckets: prometheus.ExponentialBuckets(100, 10, 6),
+	}, []string{"method", "route"})
+
+	backendRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_backend_requests_total",
+		Help: "gRPC calls to backends, by backend, method and status code.",
+	}, []string{"backend", "method", "code"})
+	backendRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gateway_backend_request_duration_seconds",
+		Help:    "Latency of gRPC calls to backends, by backend and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"backend", "method"})
+
+	redisCommandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "gateway_redis_command_duration_seconds",
+		Help:    "Latency of Redis commands, by command; pipelines are counted as one.",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 2, 14),
+	}, []string{"command"})
+)
+
+// Metrics records request count, latency, in-flight requests and response
+// size for every request. It should run first so the latency covers the
+// rest of the chain.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		method := metricMethod(c.Request.Method)
+		route := c.FullPath()
+		if route == "" {
+			route = routeUnmatched
+		}
+
+		inFlight := httpRequestsInFlight.WithLabelValues(method, route)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		start := time.Now()
+		c.Next()
+
+		size := c.Writer.Size()
+		if size < 0 {
+			size = 0
+		}
+		httpRequests.WithLabelValues(method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		httpRequestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+		httpResponseSize.WithLabelValues(method, route).Observe(float64(size))
+	}
+}
+
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace:
+		return method
+	}
+	return methodOther
+}
+
+// MetricsInterceptor records the outcome and latency of each call to
+// backend. method is the full gRPC method name, which the proto defines.
+func MetricsInterceptor(backend string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		backendRequestDuration.WithLabelValues(backend, method).Observe(time.Since(start).Seconds())
+		backendRequests.WithLabelValues(backend, method, status.Code(err).String()).Inc()
+		return err
+	}
+}
+
+// RedisMetricsHook records the latency of each Redis command or pipeline.
+func RedisMetricsHook() redis.Hook {
+	return redisMetricsHook{}
+}
+
+type redisStartKey struct{}
+
+type redisMetricsHook struct{}
+
+func (redisMetricsHook) BeforeProcess(ctx context.Context, _ redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, redisStartKey{}, time.Now()), nil
+}
+
+func (redisMetricsHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	observeRedis(ctx, cmd.Name())
+	return nil
+}
+
+func (redisMetricsHook) BeforeProcessPipeline(ctx context.Context, _ []redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, redisStartKey{}, time.Now()), nil
+}
+
+func (redisMetricsHook) AfterProcessPipeline(ctx context.Context, _ []redis.Cmder) error {
+	observeRedis(ctx, "pipeline")
+	return nil
+}
+
+func observeRedis(ctx context.Context, command string) {
+	if start, ok := ctx.Value(redisStartKey{}).(time.Time); ok {
+		redisCommandDuration.WithLabelValues(command).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,333 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/hsibAD/api-gateway/internal/config"
+	"github.com/hsibAD/api-gateway/internal/problem"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var ErrUnknownPlan = errors.New("unknown quota plan")
+
+var quotaDegraded = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "gateway_quota_degraded",
+	Help: "1 while quotas cannot reach Redis and requests pass uncounted.",
+})
+
+const (
+	quotaCounterPrefix = "quota:"
+	quotaSubjectPrefix = "quota_subject:"
+)
+
+// quotaScript checks both windows before counting, so a request rejected
+// by the monthly quota does not eat into the daily one. Limits of 0 mean
+// unlimited.
+var quotaScript = redis.NewScript(`
+local day = tonumber(redis.call('GET', KEYS[1]) or '0')
+local month = tonumber(redis.call('GET', KEYS[2]) or '0')
+local day_limit = tonumber(ARGV[1])
+local month_limit = tonumber(ARGV[2])
+
+if day_limit > 0 and day >= day_limit then
+	return {0, day, month, 'day'}
+end
+if month_limit > 0 and month >= month_limit then
+	return {0, day, month, 'month'}
+end
+
+day = redis.call('INCR', KEYS[1])
+if day == 1 then
+	redis.call('EXPIRE', KEYS[1], ARGV[3])
+end
+month = redis.call('INCR', KEYS[2])
+if month == 1 then
+	redis.call('EXPIRE', KEYS[2], ARGV[4])
+end
+return {1, day, month, ''}
+`)
+
+// QuotaWindow is the usage of one subject in one period.
+type QuotaWindow struct {
+	Limit     int64     `json:"limit"`
+	Used      int64     `json:"used"`
+	Remaining int64     `json:"remaining"`
+	ResetsAt  time.Time `json:"resets_at"`
+}
+
+type QuotaUsage struct {
+	Subject string      `json:"subject"`
+	Plan    string      `json:"plan"`
+	Day     QuotaWindow `json:"day"`
+	Month   QuotaWindow `json:"month"`
+}
+
+// QuotaManager enforces long-window request quotas. Each subject (a user or
+// an API key) is on a named plan; admins can move subjects between plans or
+// give them individual limits.
+type QuotaManager struct {
+	redis       *redis.Client
+	plans       map[string]config.QuotaPlan
+	defaultPlan string
+	// timeout and breaker keep an unreachable Redis from slowing down every
+	// request, as FailoverAlgorithm does for rate limiting.
+	timeout time.Duration
+	breaker *circuitBreaker
+}
+
+func NewQuotaManager(client *redis.Client, quotaConfig *config.QuotaConfig, timeout time.Duration, threshold int, cooldown time.Duration) (*QuotaManager, error) {
+	plans, err := loadPlans(quotaConfig)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := plans[quotaConfig.DefaultPlan]; !ok {
+		return nil, fmt.Errorf("default quota plan %q is not defined", quotaConfig.DefaultPlan)
+	}
+
+	return &QuotaManager{
+		redis:       client,
+		plans:       plans,
+		defaultPlan: quotaConfig.DefaultPlan,
+		timeout:     timeout,
+		breaker: newCircuitBreaker(threshold, cooldown, func(open bool) {
+			if open {
+				quotaDegraded.Set(1)
+				fmt.Println("Quotas lost Redis, requests pass uncounted")
+				return
+			}
+			quotaDegraded.Set(0)
+			fmt.Println("Quotas reconnected to Redis")
+		}),
+	}, nil
+}
+
+// loadPlans reads the plans from PlanFile if set, otherwise from the config.
+func loadPlans(cfg *config.QuotaConfig) (map[string]config.QuotaPlan, error) {
+	if cfg.PlanFile == "" {
+		return cfg.Plans, nil
+	}
+
+	data, err := os.ReadFile(cfg.PlanFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quota plans %s: %w", cfg.PlanFile, err)
+	}
+	var plans map[string]config.QuotaPlan
+	if err := json.Unmarshal(data, &plans); err != nil {
+		return nil, fmt.Errorf("failed to parse quota plans %s: %w", cfg.PlanFile, err)
+	}
+	return plans, nil
+}
+
+// QuotaSubject names whose quota a request counts against: the API key if
+// one was used, otherwise the user.
+func QuotaSubject(c *gin.Context) string {
+	if keyID := c.GetString("api_key_id"); keyID != "" {
+		return "api_key:" + keyID
+	}
+	return "user:" + c.GetString("user_id")
+}
+
+// Middleware counts the request against the caller's quota. It must run
+// after authentication. Quotas are a billing concern rather than overload
+// protection, so a Redis failure lets the request through.
+func (qm *QuotaManager) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subject := QuotaSubject(c)
+		now := time.Now().UTC()
+
+		if !qm.breaker.Allow() {
+			c.Next()
+			return
+		}
+		plan, limits, values, err := qm.count(c.Request.Context(), subject, now)
+		if err != nil {
+			// A client hanging up is not Redis' fault.
+			if c.Request.Context().Err() != nil {
+				qm.breaker.Abort()
+			} else {
+				qm.breaker.Failure()
+			}
+			c.Next()
+			return
+		}
+		qm.breaker.Success()
+
+		day := window(limits.RequestsPerDay, values[1].(int64), dayEnd(now))
+		month := window(limits.RequestsPerMonth, values[2].(int64), monthEnd(now))
+
+		c.Header("X-Quota-Plan", plan)
+		if remaining, ok := tightest(day, month); ok {
+			c.Header("X-Quota-Remaining", strconv.FormatInt(remaining.Remaining, 10))
+			c.Header("X-Quota-Reset", strconv.FormatInt(int64(time.Until(remaining.ResetsAt).Seconds()), 10))
+		}
+
+		if values[0].(int64) == 0 {
+			exhausted := day
+			if values[3].(string) == "month" {
+				exhausted = month
+			}
+			problem.AbortWithFields(c, http.StatusTooManyRequests, "quota exceeded", gin.H{
+				"period": values[3].(string),
+				"plan":   plan,
+				"reset":  int64(time.Until(exhausted.ResetsAt).Seconds()),
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// count resolves the subject's limits and counts the request, within the
+// Redis timeout. values is the reply of quotaScript.
+func (qm *QuotaManager) count(ctx context.Context, subject string, now time.Time) (string, config.QuotaPlan, []interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, qm.timeout)
+	defer cancel()
+
+	plan, limits, err := qm.limits(ctx, subject)
+	if err != nil {
+		return "", config.QuotaPlan{}, nil, err
+	}
+
+	dayKey, monthKey := quotaKeys(subject, now)
+	values, err := quotaScript.Run(ctx, qm.redis, []string{dayKey, monthKey},
+		limits.RequestsPerDay, limits.RequestsPerMonth,
+		int(dayEnd(now).Sub(now).Seconds())+3600, int(monthEnd(now).Sub(now).Seconds())+3600).Slice()
+	if err != nil {
+		return "", config.QuotaPlan{}, nil, err
+	}
+	return plan, limits, values, nil
+}
+
+func (qm *QuotaManager) Usage(ctx context.Context, subject string) (*QuotaUsage, error) {
+	plan, limits, err := qm.limits(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	dayKey, monthKey := quotaKeys(subject, now)
+	values, err := qm.redis.MGet(ctx, dayKey, monthKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return &QuotaUsage{
+		Subject: subject,
+		Plan:    plan,
+		Day:     window(limits.RequestsPerDay, parseCount(values[0]), dayEnd(now)),
+		Month:   window(limits.RequestsPerMonth, parseCount(values[1]), monthEnd(now)),
+	}, nil
+}
+
+// Assign moves the subject to a plan and/or overrides its limits. A nil
+// override keeps the plan's limit for that window.
+func (qm *QuotaManager) Assign(ctx context.Context, subject, plan string, perDay, perMonth *int64) error {
+	fields := map[string]interface{}{}
+	if plan != "" {
+		if _, ok := qm.plans[plan]; !ok {
+			return ErrUnknownPlan
+		}
+		fields["plan"] = plan
+	}
+	if perDay != nil {
+		fields["day"] = *perDay
+	}
+	if perMonth != nil {
+		fields["month"] = *perMonth
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	return qm.redis.HSet(ctx, quotaSubjectPrefix+subject, fields).Err()
+}
+
+// ClearOverrides drops individual limits so the subject's plan applies again.
+func (qm *QuotaManager) ClearOverrides(ctx context.Context, subject string) error {
+	return qm.redis.HDel(ctx, quotaSubjectPrefix+subject, "day", "month").Err()
+}
+
+// Reset zeroes the subject's usage for the current day and month.
+func (qm *QuotaManager) Reset(ctx context.Context, subject string) error {
+	dayKey, monthKey := quotaKeys(subject, time.Now().UTC())
+	return qm.redis.Del(ctx, dayKey, monthKey).Err()
+}
+
+// limits resolves the subject's plan and effective limits in one round trip.
+func (qm *QuotaManager) limits(ctx context.Context, subject string) (string, config.QuotaPlan, error) {
+	values, err := qm.redis.HMGet(ctx, quotaSubjectPrefix+subject, "plan", "day", "month").Result()
+	if err != nil {
+		return "", config.QuotaPlan{}, err
+	}
+
+	name, _ := values[0].(string)
+	plan, ok := qm.plans[name]
+	if !ok {
+		name = qm.defaultPlan
+		plan = qm.plans[name]
+	}
+	if values[1] != nil {
+		plan.RequestsPerDay = parseCount(values[1])
+	}
+	if values[2] != nil {
+		plan.RequestsPerMonth = parseCount(values[2])
+	}
+	return name, plan, nil
+}
+
+func quotaKeys(subject string, now time.Time) (string, string) {
+	return quotaCounterPrefix + subject + ":day:" + now.Format("20060102"),
+		quotaCounterPrefix + subject + ":month:" + now.Format("200601")
+}
+
+func dayEnd(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+}
+
+func monthEnd(now time.Time) time.Time {
+	return time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func window(limit, used int64, resetsAt time.Time) QuotaWindow {
+	remaining := int64(-1)
+	if limit > 0 {
+		remaining = limit - used
+		if remaining < 0 {
+			remaining = 0
+		}
+	}
+	return QuotaWindow{
+		Limit:     limit,
+		Used:      used,
+		Remaining: remaining,
+		ResetsAt:  resetsAt,
+	}
+}
+
+// tightest returns the limited window with the fewest requests left.
+func tightest(windows ...QuotaWindow) (QuotaWindow, bool) {
+	var best QuotaWindow
+	found := false
+	for _, w := range windows {
+		if w.Limit > 0 && (!found || w.Remaining < best.Remaining) {
+			best, found = w, true
+		}
+	}
+	return best, found
+}
+
+func parseCount(value interface{}) int64 {
+	s, _ := value.(string)
+	count, _ := strconv.ParseInt(s, 10, 64)
+	return count
+}
@@ -0,0 +1,235 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/hsibAD/api-gateway/internal/config"
+)
+
+var testQuotaConfig = &config.QuotaConfig{
+	DefaultPlan: "free",
+	Plans: map[string]config.QuotaPlan{
+		"free": {RequestsPerDay: 2, RequestsPerMonth: 3},
+		"pro":  {RequestsPerMonth: 100},
+	},
+}
+
+func newTestQuotaManager(t *testing.T, client *redis.Client) *QuotaManager {
+	t.Helper()
+	qm, err := NewQuotaManager(client, testQuotaConfig, time.Second, 2, time.Minute)
+	if err != nil {
+		t.Fatalf("NewQuotaManager: %v", err)
+	}
+	return qm
+}
+
+// quotaStatus sends a request as user through qm's middleware.
+func quotaStatus(t *testing.T, qm *QuotaManager, user string) *httptest.ResponseRecorder {
+	t.Helper()
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set("user_id", user) }, qm.Middleware())
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	return w
+}
+
+func TestQuotaRollover(t *testing.T) {
+	_, client := newTestMiniredis(t)
+	qm := newTestQuotaManager(t, client)
+
+	at := func(value string) time.Time {
+		now, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return now
+	}
+	steps := []struct {
+		now     time.Time
+		allowed bool
+		period  string
+	}{
+		{at("2024-01-31T10:00:00Z"), true, ""},
+		{at("2024-01-31T23:59:00Z"), true, ""},
+		{at("2024-01-31T23:59:59Z"), false, "day"},
+		// A new day in a new month.
+		{at("2024-02-01T00:00:00Z"), true, ""},
+		{at("2024-02-01T12:00:00Z"), true, ""},
+		{at("2024-02-02T00:00:00Z"), true, ""},
+		// The day has room, the month does not.
+		{at("2024-02-03T00:00:00Z"), false, "month"},
+		{at("2024-02-29T23:59:59Z"), false, "month"},
+		{at("2024-03-01T00:00:00Z"), true, ""},
+	}
+	for _, step := range steps {
+		_, _, values, err := qm.count(context.Background(), "user:1", step.now)
+		if err != nil {
+			t.Fatalf("%s: count: %v", step.now, err)
+		}
+		allowed, period := values[0].(int64) == 1, values[3].(string)
+		if allowed != step.allowed || period != step.period {
+			t.Errorf("%s: allowed %v (%q), want %v (%q)", step.now, allowed, period, step.allowed, step.period)
+		}
+	}
+
+	// Rejected requests are not counted.
+	day, _ := quotaKeys("user:1", at("2024-02-03T00:00:00Z"))
+	if exists, _ := client.Exists(context.Background(), day).Result(); exists != 0 {
+		t.Errorf("a request rejected by the monthly quota counted against its day")
+	}
+}
+
+func TestQuotaMiddleware(t *testing.T) {
+	_, client := newTestMiniredis(t)
+	qm := newTestQuotaManager(t, client)
+
+	for i, want := range []string{"1", "0"} {
+		w := quotaStatus(t, qm, "1")
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d, want 200", i, w.Code)
+		}
+		if plan, remaining := w.Header().Get("X-Quota-Plan"), w.Header().Get("X-Quota-Remaining"); plan != "free" || remaining != want {
+			t.Errorf("request %d: plan %q with %s remaining, want free with %s", i, plan, remaining, want)
+		}
+	}
+	if w := quotaStatus(t, qm, "1"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("request over the quota: status %d, want 429", w.Code)
+	}
+	if w := quotaStatus(t, qm, "2"); w.Code != http.StatusOK {
+		t.Errorf("another user: status %d, want 200", w.Code)
+	}
+}
+
+func TestQuotaPlans(t *testing.T) {
+	_, client := newTestMiniredis(t)
+	qm := newTestQuotaManager(t, client)
+	ctx := context.Background()
+	limit := func(n int64) *int64 { return &n }
+
+	usage := func() *QuotaUsage {
+		t.Helper()
+		usage, err := qm.Usage(ctx, "api_key:k1")
+		if err != nil {
+			t.Fatalf("Usage: %v", err)
+		}
+		return usage
+	}
+
+	if u := usage(); u.Plan != "free" || u.Day.Limit != 2 || u.Month.Limit != 3 {
+		t.Errorf("new subject: %+v, want the default plan", u)
+	}
+	if err := qm.Assign(ctx, "api_key:k1", "pro", nil, nil); err != nil {
+		t.Fatalf("Assign: %v", err)
+	}
+	if u := usage(); u.Plan != "pro" || u.Day.Remaining != -1 || u.Month.Limit != 100 {
+		t.Errorf("on pro: %+v, want an unlimited day and 100 a month", u)
+	}
+	if err := qm.Assign(ctx, "api_key:k1", "", limit(10), nil); err != nil {
+		t.Fatalf("Assign: %v", err)
+	}
+	if u := usage(); u.Plan != "pro" || u.Day.Limit != 10 || u.Month.Limit != 100 {
+		t.Errorf("with a daily override: %+v, want 10 a day on pro", u)
+	}
+	if err := qm.ClearOverrides(ctx, "api_key:k1"); err != nil {
+		t.Fatalf("ClearOverrides: %v", err)
+	}
+	if u := usage(); u.Day.Limit != 0 {
+		t.Errorf("after ClearOverrides: %+v, want the plan's limits", u)
+	}
+	if err := qm.Assign(ctx, "api_key:k1", "platinum", nil, nil); !errors.Is(err, ErrUnknownPlan) {
+		t.Errorf("Assign of an unknown plan error = %v, want ErrUnknownPlan", err)
+	}
+
+	// Usage and Reset.
+	quotaStatus(t, qm, "1")
+	u, err := qm.Usage(ctx, "user:1")
+	if err != nil {
+		t.Fatalf("Usage: %v", err)
+	}
+	if u.Day.Used != 1 || u.Day.Remaining != 1 || u.Month.Used != 1 {
+		t.Errorf("usage after one request: %+v", u)
+	}
+	if err := qm.Reset(ctx, "user:1"); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	if u, _ := qm.Usage(ctx, "user:1"); u.Day.Used != 0 || u.Month.Used != 0 {
+		t.Errorf("usage after Reset: %+v, want none", u)
+	}
+}
+
+func TestQuotaFailsOpen(t *testing.T) {
+	server, client := newTestMiniredis(t)
+	qm := newTestQuotaManager(t, client)
+
+	server.SetError("ERR unavailable")
+	for i := 0; i < 4; i++ {
+		w := quotaStatus(t, qm, "1")
+		if w.Code != http.StatusOK || w.Header().Get("X-Quota-Plan") != "" {
+			t.Fatalf("request %d without Redis: status %d, headers %v, want 200 uncounted", i, w.Code, w.Header())
+		}
+	}
+	if !qm.breaker.Open() {
+		t.Fatalf("breaker closed after failures past the threshold")
+	}
+
+	server.SetError("")
+	endCooldown(qm.breaker)
+	if w := quotaStatus(t, qm, "1"); w.Header().Get("X-Quota-Remaining") != "1" {
+		t.Errorf("after recovery: %v remaining, want 1, counting from Redis again", w.Header().Get("X-Quota-Remaining"))
+	}
+	if qm.breaker.Open() {
+		t.Errorf("breaker still open after a successful probe")
+	}
+}
+
+func TestQuotaRedisTimeout(t *testing.T) {
+	// A server that accepts connections and never answers.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	client := redis.NewClient(&redis.Options{Addr: listener.Addr().String(), MaxRetries: -1})
+	t.Cleanup(func() { client.Close() })
+	qm, err := NewQuotaManager(client, testQuotaConfig, 50*time.Millisecond, 1, time.Minute)
+	if err != nil {
+		t.Fatalf("NewQuotaManager: %v", err)
+	}
+
+	start := time.Now()
+	if w := quotaStatus(t, qm, "1"); w.Code != http.StatusOK {
+		t.Errorf("status %d, want 200", w.Code)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("request took %s, want about the 50ms timeout", elapsed)
+	}
+	if !qm.breaker.Open() {
+		t.Errorf("a timeout did not count as a failure")
+	}
+}
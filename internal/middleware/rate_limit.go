@@ -2,6 +2,9 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
 	"strconv"
 	"time"
@@ -9,79 +12,226 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
 	"github.com/hsibAD/api-gateway/internal/config"
+	"github.com/hsibAD/api-gateway/internal/problem"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var ErrUnknownPolicy = errors.New("unknown rate limit policy")
+
+var rateLimitDecisions = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "gateway_rate_limit_decisions_total",
+	Help: "Rate limit checks, by policy and decision (allowed or denied).",
+}, []string{"policy", "decision"})
+
+// globalPolicy names the coarse per-IP limit in headers and counter keys.
+const globalPolicy = "global"
+
 type RateLimiter struct {
-	redis  *redis.Client
-	config *config.RateLimitConfig
+	algorithm Algorithm
+	config    *config.RateLimitConfig
+	policies  []*rateLimitPolicy
 }
 
-func NewRateLimiter(redisConfig *config.RedisConfig, rateLimitConfig *config.RateLimitConfig) *RateLimiter {
-	client := redis.NewClient(&redis.Options{
-		Addr:     redisConfig.URL,
-		Password: redisConfig.Password,
-		DB:       redisConfig.DB,
-	})
+// NewRateLimitAlgorithm builds the configured algorithm on top of client,
+// guarded by a FailoverAlgorithm. Its circuit breaker and fallback buckets
+// are state worth keeping when only the policies change.
+func NewRateLimitAlgorithm(client *redis.Client, rateLimitConfig *config.RateLimitConfig) (Algorithm, error) {
+	primary, err := NewAlgorithm(rateLimitConfig.Algorithm, client)
+	if err != nil {
+		return nil, err
+	}
 
-	return &RateLimiter{
-		redis:  client,
-		config: rateLimitConfig,
+	return NewFailoverAlgorithm(primary, rateLimitConfig.FailureMode, rateLimitConfig.RedisTimeout,
+		rateLimitConfig.BreakerThreshold, rateLimitConfig.BreakerCooldown)
+}
+
+func NewRateLimiter(algorithm Algorithm, rateLimitConfig *config.RateLimitConfig) (*RateLimiter, error) {
+	policies, err := loadPolicies(rateLimitConfig)
+	if err != nil {
+		return nil, err
 	}
+
+	return &RateLimiter{
+		algorithm: algorithm,
+		config:    rateLimitConfig,
+		policies:  policies,
+	}, nil
 }
 
+// Middleware applies the coarse per-IP limit to every request. It runs
+// before authentication, so keep RequestsPerMinute generous enough for many
+// users behind one NAT and rely on PolicyMiddleware for finer limits.
 func (rl *RateLimiter) Middleware() gin.HandlerFunc {
+	limit := Limit{
+		Rate:   rl.config.RequestsPerMinute,
+		Period: time.Minute,
+		Burst:  rl.config.BurstSize,
+	}
+
 	return func(c *gin.Context) {
 		// Get client IP
 		clientIP := c.ClientIP()
-		key := "rate_limit:" + clientIP
-
-		ctx := context.Background()
-		now := time.Now().Unix()
-		windowStart := now - 60 // 1-minute window
+		key := counterKey(globalPolicy, "ip="+clientIP)
 
-		// Clean up old requests
-		rl.redis.ZRemRangeByScore(ctx, key, "0", strconv.FormatInt(windowStart, 10))
+		rl.enforce(c, globalPolicy, key, limit)
+	}
+}
 
-		// Count requests in the current window
-		recentRequests, err := rl.redis.ZCount(ctx, key, strconv.FormatInt(windowStart, 10), strconv.FormatInt(now, 10)).Result()
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "rate limit check failed"})
-			return
+// PolicyMiddleware applies the first policy matching the request. Mount it
+// after authentication so policies can key on the user, API key and role.
+func (rl *RateLimiter) PolicyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, policy := range rl.policies {
+			if policy.matches(c) {
+				rl.enforce(c, policy.name, policy.key(c), policy.limit)
+				return
+			}
 		}
+		c.Next()
+	}
+}
 
-		// Check if rate limit is exceeded
-		if recentRequests >= int64(rl.config.RequestsPerMinute) {
-			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
-				"error": "rate limit exceeded",
-				"limit": rl.config.RequestsPerMinute,
-				"reset": 60 - (now % 60), // Seconds until the next window
-			})
+func (rl *RateLimiter) enforce(c *gin.Context, policy, key string, limit Limit) {
+	if c.GetBool("ip_allowlisted") {
+		c.Next()
+		return
+	}
+
+	result, err := rl.algorithm.Allow(c.Request.Context(), key, limit)
+	if err != nil {
+		if errors.Is(err, ErrRateLimiterUnavailable) {
+			problem.Abort(c, http.StatusServiceUnavailable, "rate limiting unavailable")
 			return
 		}
+		problem.Abort(c, http.StatusInternalServerError, "rate limit check failed")
+		return
+	}
+
+	// The last decision on a request is the one that let it through or
+	// stopped it.
+	trace.SpanFromContext(c.Request.Context()).SetAttributes(
+		attribute.String("gateway.rate_limit.policy", policy),
+		attribute.Bool("gateway.rate_limit.allowed", result.Allowed),
+		attribute.Int("gateway.rate_limit.remaining", result.Remaining),
+	)
+
+	// Headers per draft-ietf-httpapi-ratelimit-headers. A request can pass
+	// both the global and a route policy, so each adds its own entry.
+	header := c.Writer.Header()
+	header.Add("RateLimit-Policy", fmt.Sprintf("%q;q=%d;w=%d", policy, result.Limit, ceilSeconds(result.Window)))
+	header.Add("RateLimit", fmt.Sprintf("%q;r=%d;t=%d", policy, result.Remaining, ceilSeconds(result.ResetAfter)))
 
-		// Record this request
-		member := redis.Z{
-			Score:  float64(now),
-			Member: now,
+	// Check if rate limit is exceeded
+	if !result.Allowed {
+		rateLimitDecisions.WithLabelValues(policy, "denied").Inc()
+		retryAfter := ceilSeconds(result.RetryAfter)
+		if retryAfter < 1 {
+			retryAfter = 1
 		}
-		err = rl.redis.ZAdd(ctx, key, &member).Err()
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		problem.AbortWithFields(c, http.StatusTooManyRequests, "rate limit exceeded", gin.H{
+			"policy": policy,
+			"limit":  result.Limit,
+			"reset":  retryAfter, // Seconds until a request can succeed
+		})
+		return
+	}
+
+	rateLimitDecisions.WithLabelValues(policy, "allowed").Inc()
+	c.Next()
+}
+
+// Counter is the current state of one rate limit key.
+type Counter struct {
+	Policy     string `json:"policy"`
+	Key        string `json:"key"`
+	Limit      int    `json:"limit"`
+	Remaining  int    `json:"remaining"`
+	ResetAfter int    `json:"reset_after"`
+	RetryAfter int    `json:"retry_after,omitempty"`
+	Window     int    `json:"window"`
+}
+
+// Counters returns the live counters for key (as built by the policy key,
+// e.g. "user=42" or "api_key=ab12|route=GET /api/v1/orders/:id") under
+// every policy, or only under policy if it is set.
+func (rl *RateLimiter) Counters(ctx context.Context, key, policy string) ([]Counter, error) {
+	limits, err := rl.limits(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	counters := []Counter{}
+	for _, name := range rl.policyNames(policy) {
+		result, err := rl.algorithm.Peek(ctx, counterKey(name, key), limits[name])
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "rate limit recording failed"})
-			return
+			return nil, err
+		}
+		if result == nil {
+			continue
 		}
+		counters = append(counters, Counter{
+			Policy:     name,
+			Key:        key,
+			Limit:      result.Limit,
+			Remaining:  result.Remaining,
+			ResetAfter: ceilSeconds(result.ResetAfter),
+			RetryAfter: ceilSeconds(result.RetryAfter),
+			Window:     ceilSeconds(result.Window),
+		})
+	}
+	return counters, nil
+}
+
+// ClearCounters resets key under every policy, or only under policy.
+func (rl *RateLimiter) ClearCounters(ctx context.Context, key, policy string) error {
+	if _, err := rl.limits(policy); err != nil {
+		return err
+	}
 
-		// Set key expiration
-		rl.redis.Expire(ctx, key, time.Minute*2)
+	for _, name := range rl.policyNames(policy) {
+		if err := rl.algorithm.Reset(ctx, counterKey(name, key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		// Set rate limit headers
-		c.Header("X-RateLimit-Limit", strconv.Itoa(rl.config.RequestsPerMinute))
-		c.Header("X-RateLimit-Remaining", strconv.FormatInt(int64(rl.config.RequestsPerMinute)-recentRequests-1, 10))
-		c.Header("X-RateLimit-Reset", strconv.FormatInt(60-(now%60), 10))
+func (rl *RateLimiter) limits(policy string) (map[string]Limit, error) {
+	limits := map[string]Limit{
+		globalPolicy: {
+			Rate:   rl.config.RequestsPerMinute,
+			Period: time.Minute,
+			Burst:  rl.config.BurstSize,
+		},
+	}
+	for _, p := range rl.policies {
+		limits[p.name] = p.limit
+	}
+	if _, ok := limits[policy]; policy != "" && !ok {
+		return nil, ErrUnknownPolicy
+	}
+	return limits, nil
+}
 
-		c.Next()
+func (rl *RateLimiter) policyNames(policy string) []string {
+	if policy != "" {
+		return []string{policy}
+	}
+	names := []string{globalPolicy}
+	for _, p := range rl.policies {
+		names = append(names, p.name)
 	}
+	return names
 }
 
-func (rl *RateLimiter) Close() error {
-	return rl.redis.Close()
-} 
\ No newline at end of file
+func counterKey(policy, key string) string {
+	return "rate_limit:" + policy + ":" + key
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Limit describes how much traffic a single key may send.
+type Limit struct {
+	// Rate is the sustained number of requests allowed per Period.
+	Rate   int
+	Period time.Duration
+	// Burst is how many requests may arrive back to back. Algorithms that
+	// have no notion of burst ignore it.
+	Burst int
+}
+
+// Result is the outcome of one rate limit check.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long a rejected client must wait before the next
+	// request can succeed; zero when allowed.
+	RetryAfter time.Duration
+	// ResetAfter is how long until the key is back to its full allowance.
+	ResetAfter time.Duration
+	// Window is the time over which Limit requests are allowed.
+	Window time.Duration
+}
+
+// Algorithm decides whether a request under the given key is allowed.
+// Implementations must be atomic across gateway instances.
+type Algorithm interface {
+	Allow(ctx context.Context, key string, limit Limit) (*Result, error)
+	// Peek reports the state of a key without counting a request. It
+	// returns nil if the key has no state, i.e. its allowance is full.
+	Peek(ctx context.Context, key string, limit Limit) (*Result, error)
+	Reset(ctx context.Context, key string) error
+}
+
+const (
+	AlgorithmTokenBucket   = "token_bucket"
+	AlgorithmSlidingWindow = "sliding_window"
+)
+
+func NewAlgorithm(name string, client *redis.Client) (Algorithm, error) {
+	switch name {
+	case AlgorithmTokenBucket, "":
+		return NewTokenBucket(client), nil
+	case AlgorithmSlidingWindow:
+		return NewSlidingWindowLog(client), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit algorithm %q", name)
+	}
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// testEpoch is where tests start the Redis clock; whole seconds keep the
+// float arithmetic in the scripts exact.
+var testEpoch = time.Unix(1700000000, 0)
+
+// limitStep is one request made after moving the Redis clock by advance.
+type limitStep struct {
+	advance    time.Duration
+	allowed    bool
+	remaining  int
+	retryAfter time.Duration
+}
+
+func runLimitSteps(t *testing.T, server *miniredis.Miniredis, algorithm Algorithm, limit Limit, steps []limitStep) {
+	t.Helper()
+	now := testEpoch
+	server.SetTime(now)
+	for i, step := range steps {
+		now = now.Add(step.advance)
+		server.SetTime(now)
+
+		result, err := algorithm.Allow(context.Background(), "key", limit)
+		if err != nil {
+			t.Fatalf("step %d: Allow: %v", i, err)
+		}
+		if result.Allowed != step.allowed || result.Remaining != step.remaining {
+			t.Errorf("step %d (+%s): allowed %v with %d remaining, want %v with %d",
+				i, now.Sub(testEpoch), result.Allowed, result.Remaining, step.allowed, step.remaining)
+		}
+		if diff := result.RetryAfter - step.retryAfter; diff < -time.Millisecond || diff > time.Millisecond {
+			t.Errorf("step %d (+%s): retry after %s, want %s", i, now.Sub(testEpoch), result.RetryAfter, step.retryAfter)
+		}
+	}
+}
+
+// testAlgorithms builds each algorithm on its own Redis.
+var testAlgorithms = map[string]func(*testing.T) (*miniredis.Miniredis, Algorithm){
+	AlgorithmTokenBucket: func(t *testing.T) (*miniredis.Miniredis, Algorithm) {
+		server, client := newTestMiniredis(t)
+		return server, NewTokenBucket(client)
+	},
+	AlgorithmSlidingWindow: func(t *testing.T) (*miniredis.Miniredis, Algorithm) {
+		server, client := newTestMiniredis(t)
+		return server, NewSlidingWindowLog(client)
+	},
+}
+
+// The previous limiter read and wrote the counter in separate commands, so
+// concurrent requests could all see the same count.
+func TestAlgorithmsConcurrentRequests(t *testing.T) {
+	limit := Limit{Rate: 20, Period: time.Minute, Burst: 20}
+	for name, setup := range testAlgorithms {
+		t.Run(name, func(t *testing.T) {
+			server, algorithm := setup(t)
+			// A frozen clock puts every request in the same instant.
+			server.SetTime(testEpoch)
+
+			var allowed atomic.Int32
+			var wg sync.WaitGroup
+			for i := 0; i < 100; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					result, err := algorithm.Allow(context.Background(), "key", limit)
+					if err != nil {
+						t.Errorf("Allow: %v", err)
+						return
+					}
+					if result.Allowed {
+						allowed.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+			if got := allowed.Load(); got != 20 {
+				t.Errorf("%d of 100 concurrent requests allowed, want 20", got)
+			}
+		})
+	}
+}
+
+func TestAlgorithmsPeekAndReset(t *testing.T) {
+	limit := Limit{Rate: 5, Period: time.Minute, Burst: 5}
+	ctx := context.Background()
+	for name, setup := range testAlgorithms {
+		t.Run(name, func(t *testing.T) {
+			server, algorithm := setup(t)
+			server.SetTime(testEpoch)
+
+			if result, err := algorithm.Peek(ctx, "key", limit); err != nil || result != nil {
+				t.Fatalf("Peek of an unused key = %+v, %v, want nil", result, err)
+			}
+			for i := 0; i < 2; i++ {
+				if _, err := algorithm.Allow(ctx, "key", limit); err != nil {
+					t.Fatalf("Allow: %v", err)
+				}
+			}
+			for i := 0; i < 2; i++ {
+				result, err := algorithm.Peek(ctx, "key", limit)
+				if err != nil {
+					t.Fatalf("Peek: %v", err)
+				}
+				if result == nil || !result.Allowed || result.Remaining != 3 {
+					t.Errorf("Peek = %+v, want allowed with 3 remaining", result)
+				}
+			}
+
+			if err := algorithm.Reset(ctx, "key"); err != nil {
+				t.Fatalf("Reset: %v", err)
+			}
+			if result, err := algorithm.Peek(ctx, "key", limit); err != nil || result != nil {
+				t.Errorf("Peek after Reset = %+v, %v, want nil", result, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hsibAD/api-gateway/internal/config"
+)
+
+// keyExtractor returns the part of the rate limit key a request contributes,
+// or "" when the request has nothing to offer (e.g. no API key).
+type keyExtractor func(c *gin.Context) string
+
+// rateLimitPolicy is a compiled config.RateLimitPolicy.
+type rateLimitPolicy struct {
+	name    string
+	methods map[string]bool
+	route   string
+	prefix  bool
+	roles   map[string]bool
+	keys    []keyExtractor
+	limit   Limit
+}
+
+// loadPolicies reads the policy table from PolicyFile if set, otherwise
+// from the config, and compiles it.
+func loadPolicies(cfg *config.RateLimitConfig) ([]*rateLimitPolicy, error) {
+	entries := cfg.Policies
+	if cfg.PolicyFile != "" {
+		data, err := os.ReadFile(cfg.PolicyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rate limit policies %s: %w", cfg.PolicyFile, err)
+		}
+		entries = nil
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, fmt.Errorf("failed to parse rate limit policies %s: %w", cfg.PolicyFile, err)
+		}
+	}
+
+	policies := make([]*rateLimitPolicy, 0, len(entries))
+	for _, entry := range entries {
+		policy, err := compilePolicy(entry)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+func compilePolicy(entry config.RateLimitPolicy) (*rateLimitPolicy, error) {
+	if entry.Name == "" {
+		return nil, fmt.Errorf("rate limit policy for %q has no name", entry.Route)
+	}
+	if entry.Name == globalPolicy {
+		return nil, fmt.Errorf("rate limit policy name %q is reserved for the per-IP limit", globalPolicy)
+	}
+	if entry.RequestsPerMinute <= 0 {
+		return nil, fmt.Errorf("rate limit policy %q needs a positive requests_per_minute", entry.Name)
+	}
+
+	policy := &rateLimitPolicy{
+		name:    entry.Name,
+		methods: make(map[string]bool),
+		roles:   make(map[string]bool),
+		limit: Limit{
+			Rate:   entry.RequestsPerMinute,
+			Period: time.Minute,
+			Burst:  entry.BurstSize,
+		},
+	}
+
+	for _, method := range entry.Methods {
+		policy.methods[strings.ToUpper(method)] = true
+	}
+	for _, role := range entry.Roles {
+		policy.roles[role] = true
+	}
+
+	policy.route, policy.prefix = strings.CutSuffix(entry.Route, "*")
+	if policy.route == "" && !policy.prefix {
+		return nil, fmt.Errorf("rate limit policy %q has no route", entry.Name)
+	}
+
+	key := entry.Key
+	if key == "" {
+		key = "ip"
+	}
+	for _, part := range strings.Split(key, "+") {
+		extractor, err := newKeyExtractor(part)
+		if err != nil {
+			return nil, fmt.Errorf("rate limit policy %q: %w", entry.Name, err)
+		}
+		policy.keys = append(policy.keys, extractor)
+	}
+	return policy, nil
+}
+
+// newKeyExtractor understands "ip", "user", "api_key", "route" and
+// "header:<Name>". Identity-based keys fall back to the client IP for
+// anonymous requests so they still share a bucket per address.
+func newKeyExtractor(name string) (keyExtractor, error) {
+	switch {
+	case name == "ip":
+		return func(c *gin.Context) string { return "ip=" + c.ClientIP() }, nil
+	case name == "user":
+		return func(c *gin.Context) string {
+			if userID := c.GetString("user_id"); userID != "" {
+				return "user=" + userID
+			}
+			return "ip=" + c.ClientIP()
+		}, nil
+	case name == "api_key":
+		return func(c *gin.Context) string {
+			if keyID := c.GetString("api_key_id"); keyID != "" {
+				return "api_key=" + keyID
+			}
+			return "ip=" + c.ClientIP()
+		}, nil
+	case name == "route":
+		return func(c *gin.Context) string { return "route=" + c.Request.Method + " " + c.FullPath() }, nil
+	case strings.HasPrefix(name, "header:"):
+		header := strings.TrimPrefix(name, "header:")
+		if header == "" {
+			return nil, fmt.Errorf("header key needs a header name")
+		}
+		return func(c *gin.Context) string {
+			if value := c.GetHeader(header); value != "" {
+				return header + "=" + value
+			}
+			return "ip=" + c.ClientIP()
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit key %q", name)
+	}
+}
+
+func (p *rateLimitPolicy) matches(c *gin.Context) bool {
+	if len(p.methods) > 0 && !p.methods[c.Request.Method] {
+		return false
+	}
+
+	route := c.FullPath()
+	if p.prefix {
+		if !strings.HasPrefix(route, p.route) {
+			return false
+		}
+	} else if route != p.route {
+		return false
+	}
+
+	return len(p.roles) == 0 || p.roles[c.GetString("role")]
+}
+
+func (p *rateLimitPolicy) key(c *gin.Context) string {
+	parts := make([]string, len(p.keys))
+	for i, extract := range p.keys {
+		parts[i] = extract(c)
+	}
+	return counterKey(p.name, strings.Join(parts, "|"))
+}
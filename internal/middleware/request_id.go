@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// Metadata keys set on every call to a backend service.
+const (
+	requestIDMetadata = "x-request-id"
+	userIDMetadata    = "x-user-id"
+	roleMetadata      = "x-user-role"
+)
+
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+type identityKey struct{}
+
+type identity struct {
+	userID string
+	role   string
+}
+
+// RequestID tags every request with an ID, taken from X-Request-ID when the
+// client or a proxy in front sent a usable one. The ID is stored as
+// "request_id", echoed in the response and forwarded to backend services.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			var err error
+			if requestID, err = newRequestID(); err != nil {
+				fmt.Printf("Failed to generate request ID: %v\n", err)
+				c.Next()
+				return
+			}
+		}
+
+		c.Set("request_id", requestID)
+		c.Header(RequestIDHeader, requestID)
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestIDKey{}, requestID))
+		c.Next()
+	}
+}
+
+// ForwardIdentity makes the authenticated caller known to backend services
+// and records it on the request's span. It runs after authentication.
+func ForwardIdentity() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := identity{
+			userID: c.GetString("user_id"),
+			role:   c.GetString("role"),
+		}
+		ctx := c.Request.Context()
+		trace.SpanFromContext(ctx).SetAttributes(semconv.EnduserID(id.userID), semconv.EnduserRole(id.role))
+		c.Request = c.Request.WithContext(context.WithValue(ctx, identityKey{}, id))
+		c.Next()
+	}
+}
+
+// RequestIDFromContext returns the ID RequestID assigned, if any.
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// MetadataInterceptor adds the request ID and the caller's user ID and
+// role to the gRPC metadata of outgoing calls.
+func MetadataInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		var pairs []string
+		if requestID := RequestIDFromContext(ctx); requestID != "" {
+			pairs = append(pairs, requestIDMetadata, requestID)
+		}
+		if id, ok := ctx.Value(identityKey{}).(identity); ok {
+			if id.userID != "" {
+				pairs = append(pairs, userIDMetadata, id.userID)
+			}
+			if id.role != "" {
+				pairs = append(pairs, roleMetadata, id.role)
+			}
+		}
+		if len(pairs) > 0 {
+			ctx = metadata.AppendToOutgoingContext(ctx, pairs...)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// Logger is gin's request log with the request ID appended.
+func Logger() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
+		if param.Latency > time.Minute {
+			param.Latency = param.Latency.Truncate(time.Second)
+		}
+		requestID, _ := param.Keys["request_id"].(string)
+		return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v | %s\n%s",
+			param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+			param.StatusCode,
+			param.Latency,
+			param.ClientIP,
+			param.Method,
+			param.Path,
+			requestID,
+			param.ErrorMessage,
+		)
+	})
+}
+
+// validRequestID accepts IDs that are safe to log and forward: short and
+// made of visible ASCII other than quotes and backslashes.
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(requestID); i++ {
+		b := requestID[i]
+		if b <= ' ' || b > '~' || b == '"' || b == '\\' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
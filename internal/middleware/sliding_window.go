@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// slidingWindowScript keeps one ZSET member per accepted request, scored by
+// its time in microseconds, and admits a request while fewer than the limit
+// fall inside the window. Members carry a random suffix so requests landing
+// in the same instant are all counted.
+var slidingWindowScript = redis.NewScript(`
+redis.replicate_commands()
+
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+
+-- Scores are formatted explicitly: Lua would print microsecond timestamps
+-- in exponent notation and lose precision.
+local score = string.format('%.0f', now)
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', string.format('%.0f', now - window))
+local count = redis.call('ZCARD', KEYS[1])
+
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', KEYS[1], score, score .. '-' .. ARGV[3])
+	count = count + 1
+	allowed = 1
+end
+redis.call('PEXPIRE', KEYS[1], math.ceil(window / 1000) + 1000)
+
+-- The window frees a slot when its oldest entry ages out.
+local retry_after = 0
+local reset_after = 0
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+if oldest[2] then
+	retry_after = tonumber(oldest[2]) + window - now
+	local newest = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+	reset_after = tonumber(newest[2]) + window - now
+end
+if allowed == 1 then
+	retry_after = 0
+end
+
+return {allowed, count, retry_after, reset_after}
+`)
+
+// SlidingWindowLog allows at most Rate requests in any Period-long window.
+// It is exact but stores one entry per request, so it suits low limits.
+type SlidingWindowLog struct {
+	redis *redis.Client
+}
+
+func NewSlidingWindowLog(client *redis.Client) *SlidingWindowLog {
+	return &SlidingWindowLog{
+		redis: client,
+	}
+}
+
+func (sw *SlidingWindowLog) Allow(ctx context.Context, key string, limit Limit) (*Result, error) {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	values, err := slidingWindowScript.Run(ctx, sw.redis, []string{key},
+		limit.Rate, limit.Period.Microseconds(), hex.EncodeToString(nonce)).Slice()
+	if err != nil {
+		return nil, err
+	}
+
+	count := int(values[1].(int64))
+	remaining := limit.Rate - count
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return &Result{
+		Allowed:    values[0].(int64) == 1,
+		Limit:      limit.Rate,
+		Remaining:  remaining,
+		RetryAfter: secondsToDuration(float64(values[2].(int64)) / 1e6),
+		ResetAfter: secondsToDuration(float64(values[3].(int64)) / 1e6),
+		Window:     limit.Period,
+	}, nil
+}
+
+func (sw *SlidingWindowLog) Peek(ctx context.Context, key string, limit Limit) (*Result, error) {
+	now, err := sw.redis.Time(ctx).Result()
+	if err != nil {
+		return nil, err
+	}
+	min := "(" + strconv.FormatInt(now.Add(-limit.Period).UnixMicro(), 10)
+
+	entries, err := sw.redis.ZRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{Min: min, Max: "+inf"}).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	expires := func(z redis.Z) time.Duration {
+		return time.UnixMicro(int64(z.Score)).Add(limit.Period).Sub(now)
+	}
+	result := &Result{
+		Allowed:    len(entries) < limit.Rate,
+		Limit:      limit.Rate,
+		Remaining:  limit.Rate - len(entries),
+		ResetAfter: expires(entries[len(entries)-1]),
+		Window:     limit.Period,
+	}
+	if result.Remaining < 0 {
+		result.Remaining = 0
+	}
+	if !result.Allowed {
+		result.RetryAfter = expires(entries[0])
+	}
+	return result, nil
+}
+
+func (sw *SlidingWindowLog) Reset(ctx context.Context, key string) error {
+	return sw.redis.Del(ctx, key).Err()
+}
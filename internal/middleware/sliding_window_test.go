@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlidingWindowLog(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit Limit
+		steps []limitStep
+	}{
+		{
+			name:  "limit per window",
+			limit: Limit{Rate: 3, Period: 10 * time.Second},
+			steps: []limitStep{
+				{0, true, 2, 0},
+				{0, true, 1, 0},
+				{0, true, 0, 0},
+				{0, false, 0, 10 * time.Second},
+				{5 * time.Second, false, 0, 5 * time.Second},
+			},
+		},
+		{
+			name:  "window edges",
+			limit: Limit{Rate: 2, Period: 10 * time.Second},
+			steps: []limitStep{
+				{0, true, 1, 0},
+				{4 * time.Second, true, 0, 0},
+				// The first request is still inside the window a
+				// microsecond before it ends...
+				{6*time.Second - time.Microsecond, false, 0, time.Microsecond},
+				// ...and out of it at exactly its end.
+				{time.Microsecond, true, 0, 0},
+				// The second one leaves four seconds later.
+				{4*time.Second - time.Microsecond, false, 0, time.Microsecond},
+				{time.Microsecond, true, 0, 0},
+			},
+		},
+		{
+			name:  "rejected requests are not counted",
+			limit: Limit{Rate: 1, Period: 10 * time.Second},
+			steps: []limitStep{
+				{0, true, 0, 0},
+				{5 * time.Second, false, 0, 5 * time.Second},
+				{5 * time.Second, true, 0, 0},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := newTestMiniredis(t)
+			runLimitSteps(t, server, NewSlidingWindowLog(client), tt.limit, tt.steps)
+		})
+	}
+}
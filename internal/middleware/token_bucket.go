@@ -0,0 +1,130 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// tokenBucketScript refills the bucket for the time elapsed since the last
+// call and takes one token if available. The Redis clock is used so every
+// gateway instance agrees on "now". Fractional values are returned as
+// strings because Lua numbers are truncated to integers on the way out.
+var tokenBucketScript = redis.NewScript(`
+redis.replicate_commands()
+
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+
+local time = redis.call('TIME')
+local now = tonumber(time[1]) + tonumber(time[2]) / 1000000
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = burst
+	ts = now
+end
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+
+local allowed = 0
+local retry_after = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry_after = (1 - tokens) / rate
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+
+return {allowed, tostring(tokens), tostring(retry_after), tostring((burst - tokens) / rate)}
+`)
+
+// TokenBucket lets a key spend up to Burst requests at once and refills at
+// Rate per Period.
+type TokenBucket struct {
+	redis *redis.Client
+}
+
+func NewTokenBucket(client *redis.Client) *TokenBucket {
+	return &TokenBucket{
+		redis: client,
+	}
+}
+
+func (tb *TokenBucket) Allow(ctx context.Context, key string, limit Limit) (*Result, error) {
+	burst := limit.Burst
+	if burst < 1 {
+		burst = 1
+	}
+	perSecond := float64(limit.Rate) / limit.Period.Seconds()
+
+	values, err := tokenBucketScript.Run(ctx, tb.redis, []string{key},
+		strconv.FormatFloat(perSecond, 'f', -1, 64), burst).Slice()
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, _ := strconv.ParseFloat(values[1].(string), 64)
+	retryAfter, _ := strconv.ParseFloat(values[2].(string), 64)
+	resetAfter, _ := strconv.ParseFloat(values[3].(string), 64)
+
+	return &Result{
+		Allowed:    values[0].(int64) == 1,
+		Limit:      burst,
+		Remaining:  int(tokens),
+		RetryAfter: secondsToDuration(retryAfter),
+		ResetAfter: secondsToDuration(resetAfter),
+		Window:     secondsToDuration(float64(burst) / perSecond),
+	}, nil
+}
+
+func (tb *TokenBucket) Peek(ctx context.Context, key string, limit Limit) (*Result, error) {
+	burst := limit.Burst
+	if burst < 1 {
+		burst = 1
+	}
+	perSecond := float64(limit.Rate) / limit.Period.Seconds()
+
+	var now *redis.TimeCmd
+	var state *redis.SliceCmd
+	_, err := tb.redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		now = pipe.Time(ctx)
+		state = pipe.HMGet(ctx, key, "tokens", "ts")
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	values := state.Val()
+	if values[0] == nil || values[1] == nil {
+		return nil, nil
+	}
+	tokens, _ := strconv.ParseFloat(values[0].(string), 64)
+	ts, _ := strconv.ParseFloat(values[1].(string), 64)
+	elapsed := float64(now.Val().UnixMicro())/1e6 - ts
+	tokens = math.Min(float64(burst), tokens+math.Max(0, elapsed)*perSecond)
+
+	result := &Result{
+		Allowed:    tokens >= 1,
+		Limit:      burst,
+		Remaining:  int(tokens),
+		ResetAfter: secondsToDuration((float64(burst) - tokens) / perSecond),
+		Window:     secondsToDuration(float64(burst) / perSecond),
+	}
+	if !result.Allowed {
+		result.RetryAfter = secondsToDuration((1 - tokens) / perSecond)
+	}
+	return result, nil
+}
+
+func (tb *TokenBucket) Reset(ctx context.Context, key string) error {
+	return tb.redis.Del(ctx, key).Err()
+}
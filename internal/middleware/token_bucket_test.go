@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit Limit
+		steps []limitStep
+	}{
+		{
+			name:  "burst then refill",
+			limit: Limit{Rate: 60, Period: time.Minute, Burst: 3},
+			steps: []limitStep{
+				{0, true, 2, 0},
+				{0, true, 1, 0},
+				{0, true, 0, 0},
+				{0, false, 0, time.Second},
+				{500 * time.Millisecond, false, 0, 500 * time.Millisecond},
+				{500 * time.Millisecond, true, 0, 0},
+				{time.Second, true, 0, 0},
+			},
+		},
+		{
+			name:  "refill is capped at the burst",
+			limit: Limit{Rate: 60, Period: time.Minute, Burst: 3},
+			steps: []limitStep{
+				{0, true, 2, 0},
+				{time.Hour, true, 2, 0},
+				{0, true, 1, 0},
+			},
+		},
+		{
+			name:  "fractional refill accumulates",
+			limit: Limit{Rate: 1, Period: 4 * time.Second, Burst: 1},
+			steps: []limitStep{
+				{0, true, 0, 0},
+				{time.Second, false, 0, 3 * time.Second},
+				{time.Second, false, 0, 2 * time.Second},
+				{2 * time.Second, true, 0, 0},
+			},
+		},
+		{
+			name:  "no burst means one at a time",
+			limit: Limit{Rate: 2, Period: time.Second},
+			steps: []limitStep{
+				{0, true, 0, 0},
+				{0, false, 0, 500 * time.Millisecond},
+				{500 * time.Millisecond, true, 0, 0},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := newTestMiniredis(t)
+			runLimitSteps(t, server, NewTokenBucket(client), tt.limit, tt.steps)
+		})
+	}
+}
+
+func TestTokenBucketResult(t *testing.T) {
+	server, client := newTestMiniredis(t)
+	server.SetTime(testEpoch)
+	limit := Limit{Rate: 60, Period: time.Minute, Burst: 10}
+
+	result, err := NewTokenBucket(client).Allow(context.Background(), "key", limit)
+	if err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	if result.Limit != 10 || result.Window != 10*time.Second || result.ResetAfter != time.Second {
+		t.Errorf("limit %d, window %s, reset after %s, want 10, 10s, 1s", result.Limit, result.Window, result.ResetAfter)
+	}
+}
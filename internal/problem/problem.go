@@ -0,0 +1,78 @@
+// Package problem writes error responses as RFC 7807 problem details.
+package problem
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ContentType = "application/problem+json"
+	// ContentTypeLegacy is negotiated by clients that expect the old
+	// {"error": "..."} shape.
+	ContentTypeLegacy = "application/json"
+)
+
+// Abort ends the request with a problem of the given status. detail is the
+// human readable explanation of this occurrence.
+func Abort(c *gin.Context, status int, detail string) {
+	AbortWithFields(c, status, detail, nil)
+}
+
+// AbortWithFields is Abort with extension members, such as "retry_after",
+// added next to the standard ones.
+func AbortWithFields(c *gin.Context, status int, detail string, fields gin.H) {
+	body := make(gin.H, len(fields)+6)
+	for name, value := range fields {
+		body[name] = value
+	}
+
+	if c.NegotiateFormat(ContentType, ContentTypeLegacy) == ContentTypeLegacy {
+		body["error"] = detail
+		c.AbortWithStatusJSON(status, body)
+		return
+	}
+
+	body["type"] = "about:blank"
+	body["title"] = Title(status)
+	body["status"] = status
+	body["detail"] = detail
+	body["instance"] = c.Request.URL.Path
+	if requestID := c.GetString("request_id"); requestID != "" {
+		body["request_id"] = requestID
+	}
+
+	// The JSON renderer keeps a Content-Type that is already set.
+	c.Header("Content-Type", ContentType)
+	c.AbortWithStatusJSON(status, body)
+}
+
+// Title is the short summary of a status, which RFC 7807 uses as the title
+// of "about:blank" problems.
+func Title(status int) string {
+	if status == 499 {
+		return "Client Closed Request"
+	}
+	if title := http.StatusText(status); title != "" {
+		return title
+	}
+	return "Error"
+}
+
+// NotFound answers requests for routes that do not exist.
+func NotFound(c *gin.Context) {
+	Abort(c, http.StatusNotFound, "no route for "+c.Request.URL.Path)
+}
+
+// MethodNotAllowed answers requests whose route exists for other methods.
+func MethodNotAllowed(c *gin.Context) {
+	Abort(c, http.StatusMethodNotAllowed, c.Request.Method+" is not allowed on "+c.Request.URL.Path)
+}
+
+// Recovery turns a panic into a 500 problem. gin logs the panic and stack.
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecovery(func(c *gin.Context, _ interface{}) {
+		Abort(c, http.StatusInternalServerError, "internal server error")
+	})
+}
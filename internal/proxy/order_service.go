@@ -14,13 +14,16 @@ type OrderServiceClient struct {
 	conn   *grpc.ClientConn
 }
 
-func NewOrderServiceClient(serviceURL string) (*OrderServiceClient, error) {
+// NewOrderServiceClient dials the order service. interceptors wrap every call,
+// outermost first.
+func NewOrderServiceClient(serviceURL string, interceptors ...grpc.UnaryClientInterceptor) (*OrderServiceClient, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	conn, err := grpc.DialContext(ctx, serviceURL,
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
 		grpc.WithBlock(),
+		grpc.WithChainUnaryInterceptor(interceptors...),
 	)
 	if err != nil {
 		return nil, err
@@ -32,6 +35,14 @@ func NewOrderServiceClient(serviceURL string) (*OrderServiceClient, error) {
 	}, nil
 }
 
+// NewOrderServiceClientFrom wraps an existing client, such as a fake in
+// tests. Close is a no-op for it.
+func NewOrderServiceClientFrom(client pb.OrderServiceClient) *OrderServiceClient {
+	return &OrderServiceClient{
+		client: client,
+	}
+}
+
 func (c *OrderServiceClient) CreateOrder(ctx context.Context, req *pb.CreateOrderRequest) (*pb.Order, error) {
 	return c.client.CreateOrder(ctx, req)
 }
@@ -70,5 +81,8 @@ func (c *OrderServiceClient) GetAvailableDeliverySlots(ctx context.Context, req
 }
 
 func (c *OrderServiceClient) Close() error {
+	if c.conn == nil {
+		return nil
+	}
 	return c.conn.Close()
 } 
\ No newline at end of file
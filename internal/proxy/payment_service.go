@@ -14,13 +14,16 @@ type PaymentServiceClient struct {
 	conn   *grpc.ClientConn
 }
 
-func NewPaymentServiceClient(serviceURL string) (*PaymentServiceClient, error) {
+// NewPaymentServiceClient dials the payment service. interceptors wrap every call,
+// outermost first.
+func NewPaymentServiceClient(serviceURL string, interceptors ...grpc.UnaryClientInterceptor) (*PaymentServiceClient, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	conn, err := grpc.DialContext(ctx, serviceURL,
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
 		grpc.WithBlock(),
+		grpc.WithChainUnaryInterceptor(interceptors...),
 	)
 	if err != nil {
 		return nil, err
@@ -32,6 +35,14 @@ func NewPaymentServiceClient(serviceURL string) (*PaymentServiceClient, error) {
 	}, nil
 }
 
+// NewPaymentServiceClientFrom wraps an existing client, such as a fake in
+// tests. Close is a no-op for it.
+func NewPaymentServiceClientFrom(client pb.PaymentServiceClient) *PaymentServiceClient {
+	return &PaymentServiceClient{
+		client: client,
+	}
+}
+
 func (c *PaymentServiceClient) InitiatePayment(ctx context.Context, req *pb.InitiatePaymentRequest) (*pb.Payment, error) {
 	return c.client.InitiatePayment(ctx, req)
 }
@@ -69,5 +80,8 @@ func (c *PaymentServiceClient) RetryPayment(ctx context.Context, req *pb.RetryPa
 }
 
 func (c *PaymentServiceClient) Close() error {
+	if c.conn == nil {
+		return nil
+	}
 	return c.conn.Close()
 } 
\ No newline at end of file
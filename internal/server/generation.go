@@ -0,0 +1,245 @@
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/hsibAD/api-gateway/internal/auth"
+	"github.com/hsibAD/api-gateway/internal/config"
+	"github.com/hsibAD/api-gateway/internal/middleware"
+	"github.com/hsibAD/api-gateway/internal/proxy"
+	"github.com/hsibAD/api-gateway/internal/tracing"
+	"github.com/hsibAD/api-gateway/internal/user"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+)
+
+// generation is everything built from one version of the config: backend
+// connections, middleware, auth and the route table. A reload builds a new
+// generation next to the running one and swaps it in; requests already in
+// flight finish on the generation they started on.
+//
+// Components holding state that a reload should not wipe (the Redis
+// connection pool, the in-memory user store, concurrency gates, the rate
+// limiter's circuit breaker and fallback buckets, the denylist cache, the
+// IP filter) are taken over from the previous generation while their
+// settings are unchanged. A rebuilt IP filter starts from the previous
+// one's Redis rules.
+type generation struct {
+	version  int64
+	loadedAt time.Time
+	config   *config.Config
+
+	router        *gin.Engine
+	orderClient   *proxy.OrderServiceClient
+	paymentClient *proxy.PaymentServiceClient
+	rateLimiter   *middleware.RateLimiter
+	rateAlgorithm middleware.Algorithm
+	quotas        *middleware.QuotaManager
+	concurrency   *middleware.ConcurrencyLimiter
+	ipFilter      *middleware.IPFilter
+	clientIP      *middleware.ClientIPResolver
+	jwtAuth       *auth.JWTAuth
+	redis         *redis.Client
+	userStore     user.Store
+	refreshTokens *auth.RefreshTokenStore
+	denylist      *auth.Denylist
+	apiKeys       *auth.APIKeyStore
+	policy        *auth.Policy
+
+	// Requests hold a read lock while they run, so taking the write lock
+	// waits for the generation to drain.
+	inFlight sync.RWMutex
+}
+
+// newGeneration builds the components for config, taking over what it can
+// from prev, the running generation (nil at startup). On error, whatever
+// was created anew is closed again.
+func newGeneration(config *config.Config, prev *generation) (_ *generation, err error) {
+	g := &generation{
+		loadedAt: time.Now(),
+		config:   config,
+	}
+	defer func() {
+		if err != nil {
+			g.close(prev)
+		}
+	}()
+
+	g.clientIP, err = middleware.NewClientIPResolver(config.Server.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+
+	// The gates count requests still running on prev, so backends never see
+	// more than the limit while it drains.
+	if prev != nil && reflect.DeepEqual(prev.config.Concurrency, config.Concurrency) {
+		g.concurrency = prev.concurrency
+	} else {
+		g.concurrency, err = middleware.NewConcurrencyLimiter(&config.Concurrency)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create concurrency limiter: %w", err)
+		}
+	}
+
+	// Initialize gRPC clients
+	g.orderClient, err = proxy.NewOrderServiceClient(config.Services.OrderServiceURL,
+		otelgrpc.UnaryClientInterceptor(),
+		middleware.MetadataInterceptor(),
+		middleware.MetricsInterceptor("order-service"),
+		g.concurrency.UnaryClientInterceptor("order-service"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create order service client: %w", err)
+	}
+
+	g.paymentClient, err = proxy.NewPaymentServiceClient(config.Services.PaymentServiceURL,
+		otelgrpc.UnaryClientInterceptor(),
+		middleware.MetadataInterceptor(),
+		middleware.MetricsInterceptor("payment-service"),
+		g.concurrency.UnaryClientInterceptor("payment-service"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create payment service client: %w", err)
+	}
+
+	if prev != nil && prev.config.Redis == config.Redis {
+		g.redis = prev.redis
+	} else {
+		g.redis = redis.NewClient(&redis.Options{
+			Addr:     config.Redis.URL,
+			Password: config.Redis.Password,
+			DB:       config.Redis.DB,
+		})
+		g.redis.AddHook(tracing.RedisHook())
+		g.redis.AddHook(middleware.RedisMetricsHook())
+	}
+	sameRedis := prev != nil && prev.redis == g.redis
+
+	// Initialize middleware
+	if sameRedis && sameRateAlgorithm(&prev.config.RateLimiting, &config.RateLimiting) {
+		g.rateAlgorithm = prev.rateAlgorithm
+	} else {
+		g.rateAlgorithm, err = middleware.NewRateLimitAlgorithm(g.redis, &config.RateLimiting)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create rate limiter: %w", err)
+		}
+	}
+	g.rateLimiter, err = middleware.NewRateLimiter(g.rateAlgorithm, &config.RateLimiting)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rate limiter: %w", err)
+	}
+	g.quotas, err = middleware.NewQuotaManager(g.redis, &config.Quotas, config.RateLimiting.RedisTimeout,
+		config.RateLimiting.BreakerThreshold, config.RateLimiting.BreakerCooldown)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create quota manager: %w", err)
+	}
+	if sameRedis && reflect.DeepEqual(prev.config.IPFilter, config.IPFilter) {
+		g.ipFilter = prev.ipFilter
+	} else {
+		var prevFilter *middleware.IPFilter
+		if prev != nil {
+			prevFilter = prev.ipFilter
+		}
+		g.ipFilter, err = middleware.NewIPFilter(g.redis, &config.IPFilter, prevFilter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create IP filter: %w", err)
+		}
+	}
+	if sameRedis && prev.config.Auth.DenylistCacheSize == config.Auth.DenylistCacheSize &&
+		prev.config.Auth.DenylistCacheTTL == config.Auth.DenylistCacheTTL {
+		g.denylist = prev.denylist
+	} else {
+		g.denylist = auth.NewDenylist(g.redis, &config.Auth)
+	}
+	g.apiKeys = auth.NewAPIKeyStore(g.redis)
+	g.jwtAuth, err = auth.NewJWTAuth(&config.Auth, g.denylist, g.apiKeys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize JWT auth: %w", err)
+	}
+	g.refreshTokens = auth.NewRefreshTokenStore(g.redis, &config.Auth)
+
+	g.policy, err = auth.LoadPolicy(&config.RBAC)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load RBAC policy: %w", err)
+	}
+
+	// The memory store is the only copy of its accounts.
+	if prev != nil && config.Users.Store == "memory" && prev.config.Users.Store == "memory" {
+		g.userStore = prev.userStore
+	} else {
+		g.userStore, err = newUserStore(config.Users.Store, g.redis)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Client addresses are resolved by clientIP; gin must not trust
+	// forwarding headers on its own. Logging and recovery are added with
+	// the rest of the middleware.
+	g.router = gin.New()
+	g.router.ForwardedByClientIP = false
+	g.router.SetTrustedProxies(nil)
+
+	return g, nil
+}
+
+func newUserStore(kind string, redisClient *redis.Client) (user.Store, error) {
+	switch kind {
+	case "redis":
+		return user.NewRedisStore(redisClient), nil
+	case "memory":
+		return user.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown user store %q", kind)
+	}
+}
+
+// sameRateAlgorithm reports whether a rate limit algorithm built for prev
+// still fits next. Policies and the global limit are read per request and
+// may differ.
+func sameRateAlgorithm(prev, next *config.RateLimitConfig) bool {
+	return prev.Algorithm == next.Algorithm &&
+		prev.FailureMode == next.FailureMode &&
+		prev.RedisTimeout == next.RedisTimeout &&
+		prev.BreakerThreshold == next.BreakerThreshold &&
+		prev.BreakerCooldown == next.BreakerCooldown
+}
+
+// retire waits for in-flight requests to finish, or for timeout, and then
+// closes what next, the generation that replaced it, did not take over.
+func (g *generation) retire(timeout time.Duration, next *generation) {
+	drained := make(chan struct{})
+	go func() {
+		g.inFlight.Lock()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(timeout):
+		fmt.Printf("Config generation %d still busy after %s, closing it anyway\n", g.version, timeout)
+	}
+	g.close(next)
+}
+
+// close releases the generation's connections and background work, except
+// those shared with keep, which may be nil.
+func (g *generation) close(keep *generation) {
+	if g.orderClient != nil {
+		g.orderClient.Close()
+	}
+	if g.paymentClient != nil {
+		g.paymentClient.Close()
+	}
+	if g.jwtAuth != nil {
+		g.jwtAuth.Close()
+	}
+	if g.ipFilter != nil && (keep == nil || keep.ipFilter != g.ipFilter) {
+		g.ipFilter.Close()
+	}
+	if g.redis != nil && (keep == nil || keep.redis != g.redis) {
+		g.redis.Close()
+	}
+}
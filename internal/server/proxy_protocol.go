@@ -0,0 +1,189 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errInvalidProxyHeader = errors.New("invalid PROXY protocol header")
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyProtocolListener accepts PROXY protocol v1 and v2 headers from
+// trusted load balancers and reports the original client as the
+// connection's remote address. Connections from anyone else are passed
+// through untouched, so a header they send fails as a malformed request.
+type proxyProtocolListener struct {
+	net.Listener
+	trusted func(netip.Addr) bool
+	timeout time.Duration
+}
+
+func newProxyProtocolListener(listener net.Listener, trusted func(netip.Addr) bool, timeout time.Duration) net.Listener {
+	return &proxyProtocolListener{
+		Listener: listener,
+		trusted:  trusted,
+		timeout:  timeout,
+	}
+}
+
+func (l *proxyProtocolListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &proxyProtocolConn{Conn: conn, listener: l}, nil
+}
+
+// proxyProtocolConn reads the header on first use rather than in Accept,
+// so a slow client cannot hold up the accept loop.
+type proxyProtocolConn struct {
+	net.Conn
+	listener *proxyProtocolListener
+
+	once   sync.Once
+	reader *bufio.Reader
+	remote net.Addr
+	err    error
+}
+
+func (c *proxyProtocolConn) init() {
+	c.once.Do(func() {
+		c.reader = bufio.NewReader(c.Conn)
+		c.remote = c.Conn.RemoteAddr()
+
+		peer, err := netip.ParseAddrPort(c.remote.String())
+		if err != nil || !c.listener.trusted(peer.Addr()) {
+			return
+		}
+
+		c.Conn.SetReadDeadline(time.Now().Add(c.listener.timeout))
+		defer c.Conn.SetReadDeadline(time.Time{})
+
+		remote, err := readProxyHeader(c.reader)
+		if err != nil {
+			c.err = err
+			return
+		}
+		if remote != nil {
+			c.remote = remote
+		}
+	})
+}
+
+func (c *proxyProtocolConn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	c.init()
+	return c.remote
+}
+
+// readProxyHeader consumes a PROXY header if the connection starts with
+// one. It returns nil when there is no header or the header carries no
+// client address (v1 UNKNOWN, v2 LOCAL).
+func readProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch first[0] {
+	case 'P':
+		sig, err := r.Peek(6)
+		if err != nil || string(sig) != "PROXY " {
+			return nil, nil
+		}
+		return readProxyV1(r)
+	case '\r':
+		sig, err := r.Peek(len(proxyV2Signature))
+		if err != nil || !bytes.Equal(sig, proxyV2Signature) {
+			return nil, nil
+		}
+		return readProxyV2(r)
+	}
+	return nil, nil
+}
+
+// readProxyV1 parses "PROXY TCP4 <src> <dst> <sport> <dport>\r\n".
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil || len(line) > 107 || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errInvalidProxyHeader
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, errInvalidProxyHeader
+	}
+
+	addr, err := netip.ParseAddr(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidProxyHeader, err)
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidProxyHeader, err)
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, uint16(port))), nil
+}
+
+// readProxyV2 parses the binary header: signature, version and command,
+// address family, payload length, then the addresses and optional TLVs.
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, errInvalidProxyHeader
+	}
+	if header[12]>>4 != 2 {
+		return nil, fmt.Errorf("%w: unsupported version", errInvalidProxyHeader)
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, errInvalidProxyHeader
+	}
+
+	switch header[12] & 0x0F {
+	case 0x0: // LOCAL: a health check from the balancer itself
+		return nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, fmt.Errorf("%w: unknown command", errInvalidProxyHeader)
+	}
+
+	switch header[13] >> 4 {
+	case 0x1: // AF_INET
+		if len(payload) < 12 {
+			return nil, errInvalidProxyHeader
+		}
+		addr := netip.AddrFrom4([4]byte(payload[0:4]))
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, binary.BigEndian.Uint16(payload[8:10]))), nil
+	case 0x2: // AF_INET6
+		if len(payload) < 36 {
+			return nil, errInvalidProxyHeader
+		}
+		addr := netip.AddrFrom16([16]byte(payload[0:16])).Unmap()
+		return net.TCPAddrFromAddrPort(netip.AddrPortFrom(addr, binary.BigEndian.Uint16(payload[32:34]))), nil
+	default: // AF_UNSPEC or AF_UNIX: nothing useful to report
+		return nil, nil
+	}
+}
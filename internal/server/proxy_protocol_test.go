@@ -0,0 +1,173 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+// proxyV2Header builds a v2 header with the given version/command and
+// family bytes around payload.
+func proxyV2Header(versionCommand, family byte, payload []byte) []byte {
+	header := append([]byte{}, proxyV2Signature...)
+	header = append(header, versionCommand, family, 0, 0)
+	binary.BigEndian.PutUint16(header[14:16], uint16(len(payload)))
+	return append(header, payload...)
+}
+
+func ipv4Payload(src, dst string, sport, dport uint16) []byte {
+	payload := make([]byte, 12)
+	copy(payload[0:4], netip.MustParseAddr(src).AsSlice())
+	copy(payload[4:8], netip.MustParseAddr(dst).AsSlice())
+	binary.BigEndian.PutUint16(payload[8:10], sport)
+	binary.BigEndian.PutUint16(payload[10:12], dport)
+	return payload
+}
+
+func ipv6Payload(src, dst string, sport, dport uint16) []byte {
+	payload := make([]byte, 36)
+	copy(payload[0:16], netip.MustParseAddr(src).AsSlice())
+	copy(payload[16:32], netip.MustParseAddr(dst).AsSlice())
+	binary.BigEndian.PutUint16(payload[32:34], sport)
+	binary.BigEndian.PutUint16(payload[34:36], dport)
+	return payload
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   string // "" for no address
+		err    bool
+	}{
+		{"v1 TCP4", []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"), "192.0.2.1:56324", false},
+		{"v1 TCP6", []byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n"), "[2001:db8::1]:56324", false},
+		{"v1 UNKNOWN", []byte("PROXY UNKNOWN\r\n"), "", false},
+		{"v1 without CRLF", []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\n"), "", true},
+		{"v1 missing field", []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324\r\n"), "", true},
+		{"v1 unknown protocol", []byte("PROXY UDP4 192.0.2.1 198.51.100.1 56324 443\r\n"), "", true},
+		{"v1 bad address", []byte("PROXY TCP4 192.0.2.x 198.51.100.1 56324 443\r\n"), "", true},
+		{"v1 bad port", []byte("PROXY TCP4 192.0.2.1 198.51.100.1 65536 443\r\n"), "", true},
+		{"v1 too long", []byte("PROXY TCP4 " + strings.Repeat(" ", 100) + "\r\n"), "", true},
+		{"v2 IPv4", proxyV2Header(0x21, 0x11, ipv4Payload("192.0.2.1", "198.51.100.1", 56324, 443)), "192.0.2.1:56324", false},
+		{"v2 IPv6", proxyV2Header(0x21, 0x21, ipv6Payload("2001:db8::1", "2001:db8::2", 56324, 443)), "[2001:db8::1]:56324", false},
+		{"v2 IPv4-mapped IPv6", proxyV2Header(0x21, 0x21, ipv6Payload("::ffff:192.0.2.1", "::ffff:198.51.100.1", 56324, 443)), "192.0.2.1:56324", false},
+		{"v2 with TLVs", proxyV2Header(0x21, 0x11, append(ipv4Payload("192.0.2.1", "198.51.100.1", 56324, 443), 0x04, 0, 1, 0)), "192.0.2.1:56324", false},
+		{"v2 LOCAL", proxyV2Header(0x20, 0x00, nil), "", false},
+		{"v2 AF_UNSPEC", proxyV2Header(0x21, 0x00, nil), "", false},
+		{"v2 version 1", proxyV2Header(0x11, 0x11, ipv4Payload("192.0.2.1", "198.51.100.1", 56324, 443)), "", true},
+		{"v2 unknown command", proxyV2Header(0x22, 0x11, ipv4Payload("192.0.2.1", "198.51.100.1", 56324, 443)), "", true},
+		{"v2 short IPv4 payload", proxyV2Header(0x21, 0x11, make([]byte, 8)), "", true},
+		{"v2 payload past the end of the stream", func() []byte {
+			header := proxyV2Header(0x21, 0x11, ipv4Payload("192.0.2.1", "198.51.100.1", 56324, 443))
+			binary.BigEndian.PutUint16(header[14:16], 1024)
+			return header
+		}(), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const body = "GET / HTTP/1.1\r\n"
+			r := bufio.NewReader(io.MultiReader(bytes.NewReader(tt.header), strings.NewReader(body)))
+
+			addr, err := readProxyHeader(r)
+			if tt.err {
+				if !errors.Is(err, errInvalidProxyHeader) {
+					t.Errorf("readProxyHeader error = %v, want errInvalidProxyHeader", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readProxyHeader: %v", err)
+			}
+			var got string
+			if addr != nil {
+				got = addr.String()
+			}
+			if got != tt.want {
+				t.Errorf("readProxyHeader = %q, want %q", got, tt.want)
+			}
+
+			if rest, _ := io.ReadAll(r); string(rest) != body {
+				t.Errorf("remaining stream = %q, want the header consumed", rest)
+			}
+		})
+	}
+}
+
+func TestReadProxyHeaderPassesThrough(t *testing.T) {
+	for _, stream := range []string{
+		"GET / HTTP/1.1\r\n",
+		"POST / HTTP/1.1\r\n",
+		"\r\n\r\nGET / HTTP/1.1\r\n",
+	} {
+		r := bufio.NewReader(strings.NewReader(stream))
+		addr, err := readProxyHeader(r)
+		if addr != nil || err != nil {
+			t.Errorf("%q: readProxyHeader = %v, %v, want nothing", stream, addr, err)
+		}
+		if rest, _ := io.ReadAll(r); string(rest) != stream {
+			t.Errorf("%q: remaining stream = %q, want it untouched", stream, rest)
+		}
+	}
+}
+
+func TestProxyProtocolListener(t *testing.T) {
+	tests := []struct {
+		name    string
+		trusted bool
+		want    string
+	}{
+		{"trusted peer", true, "192.0.2.1:56324"},
+		{"untrusted peer", false, "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			listener := newProxyProtocolListener(inner, func(netip.Addr) bool { return tt.trusted }, time.Second)
+			defer listener.Close()
+
+			const header = "PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"
+			go func() {
+				client, err := net.Dial("tcp", inner.Addr().String())
+				if err != nil {
+					return
+				}
+				defer client.Close()
+				client.Write([]byte(header + "ping"))
+			}()
+
+			conn, err := listener.Accept()
+			if err != nil {
+				t.Fatalf("Accept: %v", err)
+			}
+			defer conn.Close()
+
+			got := conn.RemoteAddr().String()
+			if !tt.trusted {
+				got, _, _ = net.SplitHostPort(got)
+			}
+			if got != tt.want {
+				t.Errorf("RemoteAddr = %s, want %s", got, tt.want)
+			}
+
+			data, _ := io.ReadAll(conn)
+			want := "ping"
+			if !tt.trusted {
+				want = header + want
+			}
+			if string(data) != want {
+				t.Errorf("read %q, want %q", data, want)
+			}
+		})
+	}
+}
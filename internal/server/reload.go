@@ -0,0 +1,204 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hsibAD/api-gateway/internal/config"
+	"github.com/hsibAD/api-gateway/internal/problem"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	configReloads = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gateway_config_reloads_total",
+		Help: "Config reload attempts, by result.",
+	}, []string{"result"})
+	configLastReloadSuccess = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gateway_config_last_reload_successful",
+		Help: "1 if the last config reload succeeded, 0 if it failed.",
+	})
+	configLastReloadTime = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gateway_config_last_reload_timestamp_seconds",
+		Help: "Time of the last config reload attempt.",
+	})
+	configGeneration = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gateway_config_generation",
+		Help: "Generation of the config currently serving requests; 1 at startup.",
+	})
+)
+
+type reloadState struct {
+	// mu serialises reloads.
+	mu   sync.Mutex
+	last *reloadResult
+}
+
+type reloadResult struct {
+	At         time.Time `json:"at"`
+	Trigger    string    `json:"trigger"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error,omitempty"`
+	Warnings   []string  `json:"warnings,omitempty"`
+	Generation int64     `json:"generation"`
+}
+
+// Reload loads and validates the config again and, if that and building
+// the new generation succeed, swaps it in. The old generation keeps
+// serving the requests it has and is closed once they are done. On failure
+// the running generation is left untouched.
+func (s *Server) Reload(trigger string) error {
+	s.reloads.mu.Lock()
+	defer s.reloads.mu.Unlock()
+
+	result := &reloadResult{At: time.Now(), Trigger: trigger}
+	err := s.reload(result)
+
+	configLastReloadTime.Set(float64(result.At.Unix()))
+	if err != nil {
+		result.Error = err.Error()
+		result.Generation = s.current.Load().version
+		configReloads.WithLabelValues("failure").Inc()
+		configLastReloadSuccess.Set(0)
+		fmt.Printf("Config reload (%s) failed, keeping generation %d: %v\n", trigger, result.Generation, err)
+	} else {
+		result.Success = true
+		configReloads.WithLabelValues("success").Inc()
+		configLastReloadSuccess.Set(1)
+		configGeneration.Set(float64(result.Generation))
+		fmt.Printf("Config reload (%s) succeeded, now serving generation %d\n", trigger, result.Generation)
+		for _, warning := range result.Warnings {
+			fmt.Printf("Config reload: %s\n", warning)
+		}
+	}
+
+	s.reloads.last = result
+	return err
+}
+
+func (s *Server) reload(result *reloadResult) error {
+	cfg, err := config.Load(s.configPath)
+	if err != nil {
+		return err
+	}
+	result.Warnings = restartRequired(s.config, cfg)
+
+	old := s.current.Load()
+	g, err := newGeneration(cfg, old)
+	if err != nil {
+		return err
+	}
+
+	g.version = old.version + 1
+	s.setupRoutes(g)
+	s.current.Store(g)
+	go old.retire(s.config.Server.ShutdownTimeout, g)
+
+	result.Generation = g.version
+	return nil
+}
+
+// restartRequired lists changed settings that only take effect on restart.
+func restartRequired(running, next *config.Config) []string {
+	var warnings []string
+	changed := func(name string, differs bool) {
+		if differs {
+			warnings = append(warnings, name+" changed; restart to apply")
+		}
+	}
+	changed("server.port", running.Server.Port != next.Server.Port)
+	changed("server.read_timeout", running.Server.ReadTimeout != next.Server.ReadTimeout)
+	changed("server.write_timeout", running.Server.WriteTimeout != next.Server.WriteTimeout)
+	changed("server.shutdown_timeout", running.Server.ShutdownTimeout != next.Server.ShutdownTimeout)
+	changed("server.proxy_protocol", running.Server.ProxyProtocol != next.Server.ProxyProtocol)
+	changed("server.config_watch_interval", running.Server.ConfigWatchInterval != next.Server.ConfigWatchInterval)
+	changed("tracing", running.Tracing != next.Tracing)
+	return warnings
+}
+
+// watchConfig reloads when the config file or a file it refers to
+// changes. Files are polled so that edits through symlink swaps, as done
+// for mounted Kubernetes ConfigMaps, are noticed too.
+func (s *Server) watchConfig(stop <-chan struct{}) {
+	interval := s.config.Server.ConfigWatchInterval
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := s.configFingerprint()
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+
+		fingerprint := s.configFingerprint()
+		if fingerprint == last {
+			continue
+		}
+		// A broken edit is reported once, not on every tick.
+		last = fingerprint
+		s.Reload("file")
+	}
+}
+
+func (s *Server) configFingerprint() string {
+	cfg := s.current.Load().config
+	paths := []string{
+		s.configPath,
+		cfg.Auth.KeySetFile,
+		cfg.RateLimiting.PolicyFile,
+		cfg.RBAC.PolicyFile,
+		cfg.Quotas.PlanFile,
+	}
+	for _, key := range cfg.Auth.SigningKeys {
+		paths = append(paths, key.KeyFile)
+	}
+
+	hash := sha256.New()
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			data = []byte("unreadable: " + err.Error())
+		}
+		sum := sha256.Sum256(data)
+		fmt.Fprintf(hash, "%s\x00%x\x00", path, sum)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func (s *Server) configStatus(c *gin.Context) {
+	s.reloads.mu.Lock()
+	last := s.reloads.last
+	s.reloads.mu.Unlock()
+
+	g := s.current.Load()
+	c.JSON(http.StatusOK, gin.H{
+		"generation":  g.version,
+		"loaded_at":   g.loadedAt,
+		"config_file": s.configPath,
+		"last_reload": last,
+	})
+}
+
+func (s *Server) reloadConfig(c *gin.Context) {
+	if err := s.Reload("api"); err != nil {
+		problem.Abort(c, http.StatusUnprocessableEntity, "config reload failed: "+err.Error())
+		return
+	}
+
+	s.configStatus(c)
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/hsibAD/api-gateway/internal/config"
+	"github.com/hsibAD/api-gateway/internal/middleware"
+	"google.golang.org/grpc"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// startTestBackend runs a gRPC server without services, enough for the
+// backend clients to connect.
+func startTestBackend(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return listener.Addr().String()
+}
+
+func TestReloadKeepsIPRules(t *testing.T) {
+	redisServer := miniredis.RunT(t)
+	redisAddr := redisServer.Addr()
+	backend := startTestBackend(t)
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	writeConfig := func(ipFilter string) {
+		t.Helper()
+		content := fmt.Sprintf("environment: development\n"+
+			"services:\n  order_service_url: %s\n  payment_service_url: %s\n"+
+			"redis:\n  url: %s\n%s", backend, backend, redisAddr, ipFilter)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeConfig("")
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	s, err := NewServer(cfg, path)
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	t.Cleanup(func() { s.current.Load().close(nil) })
+
+	rule := &middleware.IPRule{CIDR: "198.51.100.0/24", Action: middleware.IPRuleDeny}
+	if err := s.current.Load().ipFilter.Add(context.Background(), rule); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	status := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.RemoteAddr = "198.51.100.7:40000"
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w.Code
+	}
+	reload := func() {
+		t.Helper()
+		if err := s.Reload("test"); err != nil {
+			t.Fatalf("Reload: %v", err)
+		}
+	}
+
+	// An unchanged ip_filter keeps the running filter.
+	before := s.current.Load().ipFilter
+	reload()
+	if s.current.Load().ipFilter != before {
+		t.Errorf("reload with the same ip_filter built a new filter")
+	}
+	if got := status(); got != http.StatusForbidden {
+		t.Errorf("after reload: status %d, want 403", got)
+	}
+
+	// A rebuilt filter has the Redis rules before it serves a request.
+	writeConfig("ip_filter:\n  allow: [203.0.113.0/24]\n")
+	reload()
+	if s.current.Load().ipFilter == before {
+		t.Fatalf("reload with a changed ip_filter kept the old filter")
+	}
+	if got := status(); got != http.StatusForbidden {
+		t.Errorf("right after rebuilding the filter: status %d, want 403", got)
+	}
+
+	// Without Redis, the rules of the filter it replaces carry over.
+	redisServer.Close()
+	writeConfig("ip_filter:\n  deny: [192.0.2.0/24]\n")
+	reload()
+	if got := status(); got != http.StatusForbidden {
+		t.Errorf("after rebuilding the filter with Redis down: status %d, want 403", got)
+	}
+}
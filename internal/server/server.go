@@ -3,127 +3,177 @@ package server
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"github.com/hsibAD/api-gateway/internal/auth"
 	"github.com/hsibAD/api-gateway/internal/config"
 	"github.com/hsibAD/api-gateway/internal/handler"
 	"github.com/hsibAD/api-gateway/internal/middleware"
-	"github.com/hsibAD/api-gateway/internal/proxy"
+	"github.com/hsibAD/api-gateway/internal/problem"
+	"github.com/hsibAD/api-gateway/internal/tracing"
 )
 
+// Server owns the listener and serves every request from the current
+// generation. Settings of the listener itself (port, timeouts, PROXY
+// protocol) and tracing are fixed at startup.
 type Server struct {
-	router        *gin.Engine
-	config        *config.Config
-	orderClient   *proxy.OrderServiceClient
-	paymentClient *proxy.PaymentServiceClient
-	rateLimiter   *middleware.RateLimiter
-	jwtAuth       *auth.JWTAuth
+	config     *config.Config
+	configPath string
+	tracing    *tracing.Provider
+	current    atomic.Pointer[generation]
+	reloads    reloadState
 }
 
-func NewServer(config *config.Config) (*Server, error) {
-	// Initialize gRPC clients
-	orderClient, err := proxy.NewOrderServiceClient(config.Services.OrderServiceURL)
+// NewServer builds the first generation from config. configPath is the
+// file config was loaded from, if any; reloads read it again.
+func NewServer(config *config.Config, configPath string) (*Server, error) {
+	// Installed first so that the generation's clients pick it up.
+	tracer, err := tracing.NewProvider(&config.Tracing)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create order service client: %w", err)
+		return nil, fmt.Errorf("failed to set up tracing: %w", err)
 	}
 
-	paymentClient, err := proxy.NewPaymentServiceClient(config.Services.PaymentServiceURL)
+	g, err := newGeneration(config, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create payment service client: %w", err)
+		tracer.Shutdown(context.Background())
+		return nil, err
 	}
 
-	// Initialize middleware
-	rateLimiter := middleware.NewRateLimiter(&config.Redis, &config.RateLimiting)
-	jwtAuth := auth.NewJWTAuth(&config.Auth)
-
 	server := &Server{
-		router:        gin.Default(),
-		config:        config,
-		orderClient:   orderClient,
-		paymentClient: paymentClient,
-		rateLimiter:   rateLimiter,
-		jwtAuth:       jwtAuth,
+		config:     config,
+		configPath: configPath,
+		tracing:    tracer,
 	}
-
-	server.setupRoutes()
+	g.version = 1
+	server.setupRoutes(g)
+	server.current.Store(g)
+	configGeneration.Set(1)
 	return server, nil
 }
 
-func (s *Server) setupRoutes() {
-	// Create handlers
-	orderHandler := handler.NewOrderHandler(s.orderClient)
-	paymentHandler := handler.NewPaymentHandler(s.paymentClient)
+// ServeHTTP pins the request to the current generation for its lifetime.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for {
+		g := s.current.Load()
+		// Fails only once g has been swapped out and is draining.
+		if g.inFlight.TryRLock() {
+			defer g.inFlight.RUnlock()
+			g.router.ServeHTTP(w, r)
+			return
+		}
+	}
+}
 
-	// Middleware
-	s.router.Use(gin.Recovery())
-	s.router.Use(s.rateLimiter.Middleware())
+func (s *Server) setupRoutes(g *generation) {
+	// Create handlers
+	orderHandler := handler.NewOrderHandler(g.orderClient, g.policy)
+	paymentHandler := handler.NewPaymentHandler(g.paymentClient, g.orderClient, g.policy)
+	authHandler := handler.NewAuthHandler(g.userStore, g.jwtAuth, g.refreshTokens, g.denylist)
+	apiKeyHandler := handler.NewAPIKeyHandler(g.apiKeys)
+	quotaHandler := handler.NewQuotaHandler(g.quotas)
+	rateLimitHandler := handler.NewRateLimitHandler(g.rateLimiter)
+	ipRuleHandler := handler.NewIPRuleHandler(g.ipFilter)
+	require := g.policy.Require
+
+	// Middleware. The client address is resolved before anything reads it.
+	g.router.Use(g.clientIP.Middleware())
+	g.router.Use(tracing.Middleware(), middleware.Metrics(), middleware.RequestID(), middleware.Logger(), problem.Recovery())
+	g.router.Use(g.ipFilter.Middleware())
+	g.router.Use(g.rateLimiter.Middleware())
+
+	// Unknown routes and methods answer with problems like everything else
+	g.router.HandleMethodNotAllowed = true
+	g.router.NoRoute(problem.NotFound)
+	g.router.NoMethod(problem.MethodNotAllowed)
 
 	// Health check and metrics
-	s.router.GET("/health", s.healthCheck)
-	s.router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	g.router.GET("/health", s.healthCheck)
+	g.router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	g.router.GET("/.well-known/jwks.json", authHandler.JWKS)
 
 	// API routes
-	api := s.router.Group("/api/v1")
+	api := g.router.Group("/api/v1")
 	{
 		// Public routes
 		auth := api.Group("/auth")
+		auth.Use(g.rateLimiter.PolicyMiddleware())
 		{
-			auth.POST("/login", s.handleLogin)
-			auth.POST("/register", s.handleRegister)
+			auth.POST("/login", authHandler.Login)
+			auth.POST("/register", authHandler.Register)
+			auth.POST("/refresh", authHandler.Refresh)
 		}
 
 		// Protected routes
 		protected := api.Group("")
-		protected.Use(s.jwtAuth.Middleware())
+		protected.Use(g.jwtAuth.Middleware(), middleware.ForwardIdentity(), g.rateLimiter.PolicyMiddleware(), g.quotas.Middleware())
 		{
+			protected.POST("/auth/logout", authHandler.Logout)
+			protected.GET("/quota", require("quota:read"), quotaHandler.GetMyQuota)
+
 			// Order routes
-			orders := protected.Group("/orders")
+			orders := protected.Group("/orders", g.concurrency.Middleware("orders", "order-service"))
 			{
-				orders.POST("", orderHandler.CreateOrder)
-				orders.GET("/:id", orderHandler.GetOrder)
-				orders.PUT("/:id/status", orderHandler.UpdateOrderStatus)
-				orders.GET("/delivery-slots", orderHandler.GetAvailableDeliverySlots)
+				orders.POST("", require("orders:write"), orderHandler.CreateOrder)
+				orders.GET("/:id", require("orders:read"), orderHandler.GetOrder)
+				orders.PUT("/:id/status", require("orders:manage"), orderHandler.UpdateOrderStatus)
+				orders.PUT("/:id/delivery-time", require("orders:write"), orderHandler.SetDeliveryTime)
+				orders.GET("/delivery-slots", require("orders:read"), orderHandler.GetAvailableDeliverySlots)
 			}
 
 			// Delivery address routes
-			addresses := protected.Group("/addresses")
+			addresses := protected.Group("/addresses", g.concurrency.Middleware("addresses", "order-service"))
 			{
-				addresses.POST("", orderHandler.AddDeliveryAddress)
-				addresses.GET("", orderHandler.ListDeliveryAddresses)
+				addresses.POST("", require("addresses:write"), orderHandler.AddDeliveryAddress)
+				addresses.GET("", require("addresses:read"), orderHandler.ListDeliveryAddresses)
+				addresses.PUT("/:id", require("addresses:write"), orderHandler.UpdateDeliveryAddress)
+				addresses.DELETE("/:id", require("addresses:write"), orderHandler.DeleteDeliveryAddress)
 			}
 
 			// Payment routes
-			payments := protected.Group("/payments")
+			payments := protected.Group("/payments", g.concurrency.Middleware("payments", "payment-service"))
+			{
+				payments.POST("", require("payments:write"), paymentHandler.InitiatePayment)
+				payments.POST("/credit-card", require("payments:write"), paymentHandler.ProcessCreditCardPayment)
+				payments.POST("/metamask/initiate", require("payments:write"), paymentHandler.InitiateMetaMaskPayment)
+				payments.POST("/metamask/confirm", require("payments:write"), paymentHandler.ConfirmMetaMaskPayment)
+				payments.GET("/:id", require("payments:read"), paymentHandler.GetPayment)
+				payments.GET("/order/:order_id", require("payments:read"), paymentHandler.GetPaymentsByOrder)
+				payments.GET("/pending", require("payments:read"), paymentHandler.GetPendingPayments)
+				payments.POST("/:id/retry", require("payments:write"), paymentHandler.RetryPayment)
+				payments.PUT("/:id/status", require("payments:manage"), paymentHandler.UpdatePaymentStatus)
+			}
+
+			// Admin routes
+			admin := protected.Group("/admin")
 			{
-				payments.POST("", paymentHandler.InitiatePayment)
-				payments.POST("/credit-card", paymentHandler.ProcessCreditCardPayment)
-				payments.POST("/metamask/initiate", paymentHandler.InitiateMetaMaskPayment)
-				payments.POST("/metamask/confirm", paymentHandler.ConfirmMetaMaskPayment)
-				payments.GET("/:id", paymentHandler.GetPayment)
-				payments.GET("/order/:order_id", paymentHandler.GetPaymentsByOrder)
-				payments.GET("/pending", paymentHandler.GetPendingPayments)
+				admin.POST("/users/:id/revoke-tokens", require("users:manage"), authHandler.RevokeUserTokens)
+				admin.POST("/keys/reload", require("signing-keys:manage"), authHandler.ReloadSigningKeys)
+				admin.POST("/api-keys", require("api-keys:manage"), apiKeyHandler.CreateAPIKey)
+				admin.GET("/api-keys", require("api-keys:read"), apiKeyHandler.ListAPIKeys)
+				admin.DELETE("/api-keys/:id", require("api-keys:manage"), apiKeyHandler.RevokeAPIKey)
+				admin.GET("/ip-rules", require("ip-rules:read"), ipRuleHandler.ListIPRules)
+				admin.POST("/ip-rules", require("ip-rules:manage"), ipRuleHandler.CreateIPRule)
+				admin.DELETE("/ip-rules/:id", require("ip-rules:manage"), ipRuleHandler.DeleteIPRule)
+				admin.GET("/rate-limits", require("rate-limits:read"), rateLimitHandler.GetCounters)
+				admin.DELETE("/rate-limits", require("rate-limits:manage"), rateLimitHandler.ClearCounters)
+				admin.GET("/config", require("config:read"), s.configStatus)
+				admin.POST("/config/reload", require("config:manage"), s.reloadConfig)
+				admin.GET("/quotas/:kind/:id", require("quotas:read"), quotaHandler.GetQuota)
+				admin.PUT("/quotas/:kind/:id", require("quotas:manage"), quotaHandler.UpdateQuota)
+				admin.POST("/quotas/:kind/:id/reset", require("quotas:manage"), quotaHandler.ResetQuota)
 			}
 		}
 	}
 }
 
-func (s *Server) handleLogin(c *gin.Context) {
-	// TODO: Implement user authentication
-	c.JSON(http.StatusOK, gin.H{"message": "login successful"})
-}
-
-func (s *Server) handleRegister(c *gin.Context) {
-	// TODO: Implement user registration
-	c.JSON(http.StatusOK, gin.H{"message": "registration successful"})
-}
-
 func (s *Server) healthCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"status": "up",
@@ -134,18 +184,40 @@ func (s *Server) healthCheck(c *gin.Context) {
 func (s *Server) Run() error {
 	srv := &http.Server{
 		Addr:         ":" + s.config.Server.Port,
-		Handler:      s.router,
+		Handler:      s,
 		ReadTimeout:  s.config.Server.ReadTimeout,
 		WriteTimeout: s.config.Server.WriteTimeout,
 	}
 
+	listener, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", srv.Addr, err)
+	}
+	if s.config.Server.ProxyProtocol {
+		trusted := func(addr netip.Addr) bool { return s.current.Load().clientIP.Trusted(addr) }
+		listener = newProxyProtocolListener(listener, trusted, s.config.Server.ReadTimeout)
+	}
+
 	// Start server in a goroutine
 	go func() {
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := srv.Serve(listener); err != nil && err != http.ErrServerClosed {
 			fmt.Printf("Failed to start server: %v\n", err)
 		}
 	}()
 
+	// Reload the config on SIGHUP and when its files change
+	stopWatching := make(chan struct{})
+	defer close(stopWatching)
+	go s.watchConfig(stopWatching)
+
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			s.Reload("signal")
+		}
+	}()
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -163,9 +235,12 @@ func (s *Server) Run() error {
 	}
 
 	// Close clients
-	s.orderClient.Close()
-	s.paymentClient.Close()
-	s.rateLimiter.Close()
+	s.current.Load().close(nil)
+
+	// Flush the remaining spans
+	if err := s.tracing.Shutdown(ctx); err != nil {
+		fmt.Printf("Failed to flush traces: %v\n", err)
+	}
 
 	return nil
-} 
\ No newline at end of file
+}
@@ -0,0 +1,74 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RedisHook records a client span for each Redis command or pipeline run
+// on behalf of a traced request. Background work such as rule refreshes
+// has no span to attach to and is left out.
+func RedisHook() redis.Hook {
+	return redisHook{tracer: otel.Tracer(tracerName)}
+}
+
+type redisHook struct {
+	tracer trace.Tracer
+}
+
+func (h redisHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return h.start(ctx, "redis "+cmd.Name(), cmd.Name()), nil
+}
+
+func (h redisHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	h.end(ctx, cmd.Err())
+	return nil
+}
+
+func (h redisHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	names := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		names[i] = cmd.Name()
+	}
+	return h.start(ctx, "redis pipeline", strings.Join(names, " ")), nil
+}
+
+func (h redisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	var err error
+	for _, cmd := range cmds {
+		if cmdErr := cmd.Err(); cmdErr != nil && cmdErr != redis.Nil {
+			err = cmdErr
+			break
+		}
+	}
+	h.end(ctx, err)
+	return nil
+}
+
+func (h redisHook) start(ctx context.Context, name, operation string) context.Context {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+	ctx, _ = h.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemRedis, semconv.DBOperation(operation)),
+	)
+	return ctx
+}
+
+// end ends the span start opened. Without one, ctx holds no span at all and
+// the no-op span found instead is safe to end.
+func (h redisHook) end(ctx context.Context, err error) {
+	span := trace.SpanFromContext(ctx)
+	if err != nil && err != redis.Nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,108 @@
+// Package tracing sets up OpenTelemetry tracing: the exporter, server spans
+// for incoming requests and client spans for Redis.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hsibAD/api-gateway/internal/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+const tracerName = "github.com/hsibAD/api-gateway"
+
+// Provider owns the process-wide tracer provider. Spans are dropped while
+// the exporter is "none", but trace context is still passed on to the
+// backends.
+type Provider struct {
+	provider *sdktrace.TracerProvider
+	file     *os.File
+}
+
+// NewProvider installs the global tracer provider and W3C trace context
+// propagation.
+func NewProvider(cfg *config.TracingConfig) (*Provider, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	p := &Provider{}
+	var processor sdktrace.SpanProcessor
+	switch cfg.Exporter {
+	case ExporterNone:
+		return p, nil
+	case ExporterOTLP:
+		options := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.Endpoint)}
+		if cfg.Insecure {
+			options = append(options, otlptracegrpc.WithInsecure())
+		}
+		// The exporter connects in the background and retries on its own.
+		exporter, err := otlptracegrpc.New(context.Background(), options...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+		processor = sdktrace.NewBatchSpanProcessor(exporter)
+	case ExporterStdout:
+		var out io.Writer = os.Stdout
+		if cfg.File != "" {
+			file, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+			if err != nil {
+				return nil, fmt.Errorf("failed to open trace file: %w", err)
+			}
+			p.file = file
+			out = file
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(out))
+		if err != nil {
+			p.Shutdown(context.Background())
+			return nil, fmt.Errorf("failed to create stdout exporter: %w", err)
+		}
+		// Written as they end, so a test can read them right away.
+		processor = sdktrace.NewSimpleSpanProcessor(exporter)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", cfg.Exporter)
+	}
+
+	res, err := resource.Merge(resource.Default(),
+		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(cfg.ServiceName)))
+	if err != nil {
+		p.Shutdown(context.Background())
+		return nil, fmt.Errorf("failed to build trace resource: %w", err)
+	}
+
+	p.provider = sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(processor),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(p.provider)
+	return p, nil
+}
+
+// Shutdown flushes the spans still buffered and closes the exporter.
+func (p *Provider) Shutdown(ctx context.Context) error {
+	var err error
+	if p.provider != nil {
+		err = p.provider.Shutdown(ctx)
+	}
+	if p.file != nil {
+		p.file.Close()
+	}
+	return err
+}
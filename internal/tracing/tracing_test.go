@@ -0,0 +1,130 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hsibAD/api-gateway/internal/config"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// exportedSpan is the part of the stdout exporter's JSON the tests read.
+type exportedSpan struct {
+	Name        string
+	SpanKind    int
+	SpanContext struct{ TraceID string }
+	Parent      struct{ SpanID string }
+	Attributes  []struct {
+		Key   string
+		Value struct{ Value interface{} }
+	}
+	Status struct{ Code string }
+}
+
+func (s exportedSpan) attribute(key string) interface{} {
+	for _, a := range s.Attributes {
+		if a.Key == key {
+			return a.Value.Value
+		}
+	}
+	return nil
+}
+
+// readSpans decodes every span written to path so far.
+func readSpans(t *testing.T, path string) []exportedSpan {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var spans []exportedSpan
+	decoder := json.NewDecoder(file)
+	for {
+		var span exportedSpan
+		if err := decoder.Decode(&span); errors.Is(err, io.EOF) {
+			return spans
+		} else if err != nil {
+			t.Fatalf("decoding spans: %v", err)
+		}
+		spans = append(spans, span)
+	}
+}
+
+func TestStdoutExporterFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.json")
+	p, err := NewProvider(&config.TracingConfig{
+		Exporter:    ExporterStdout,
+		File:        path,
+		ServiceName: "api-gateway",
+		SampleRatio: 1,
+	})
+	if err != nil {
+		t.Fatalf("NewProvider: %v", err)
+	}
+	t.Cleanup(func() { p.Shutdown(context.Background()) })
+
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/orders/:id", func(c *gin.Context) { c.Status(http.StatusBadGateway) })
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/orders/42", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	// Spans are written as they end, without waiting for Shutdown.
+	spans := readSpans(t, path)
+	if len(spans) != 1 {
+		t.Fatalf("exported %d spans, want 1", len(spans))
+	}
+	span := spans[0]
+	if span.Name != "GET /orders/:id" {
+		t.Errorf("span name = %q, want the route template", span.Name)
+	}
+	if span.SpanContext.TraceID != traceID || span.Parent.SpanID != "00f067aa0ba902b7" {
+		t.Errorf("span trace/parent = %s/%s, want the incoming traceparent", span.SpanContext.TraceID, span.Parent.SpanID)
+	}
+	if got := span.attribute("http.route"); got != "/orders/:id" {
+		t.Errorf("http.route = %v, want /orders/:id", got)
+	}
+	if got := span.attribute("http.status_code"); got != float64(http.StatusBadGateway) {
+		t.Errorf("http.status_code = %v, want %d", got, http.StatusBadGateway)
+	}
+	if span.Status.Code != "Error" {
+		t.Errorf("status = %q, want Error for a 5xx", span.Status.Code)
+	}
+
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+}
+
+func TestNewProviderExporters(t *testing.T) {
+	p, err := NewProvider(&config.TracingConfig{Exporter: ExporterNone})
+	if err != nil {
+		t.Fatalf("NewProvider(none): %v", err)
+	}
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown(none): %v", err)
+	}
+
+	if _, err := NewProvider(&config.TracingConfig{Exporter: "zipkin"}); err == nil {
+		t.Errorf("NewProvider accepted an unknown exporter")
+	}
+	if _, err := NewProvider(&config.TracingConfig{Exporter: ExporterStdout, File: t.TempDir()}); err == nil {
+		t.Errorf("NewProvider accepted a directory as the trace file")
+	}
+}
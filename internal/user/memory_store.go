@@ -0,0 +1,57 @@
+package user
+
+import (
+	"context"
+	"sync"
+)
+
+type MemoryStore struct {
+	mu      sync.RWMutex
+	byID    map[string]*User
+	byEmail map[string]string
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		byID:    make(map[string]*User),
+		byEmail: make(map[string]string),
+	}
+}
+
+func (s *MemoryStore) Create(ctx context.Context, user *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	email := NormalizeEmail(user.Email)
+	if _, exists := s.byEmail[email]; exists {
+		return ErrEmailTaken
+	}
+
+	stored := *user
+	stored.Email = email
+	s.byID[stored.ID] = &stored
+	s.byEmail[email] = stored.ID
+	return nil
+}
+
+func (s *MemoryStore) GetByID(ctx context.Context, id string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, exists := s.byID[id]
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+	user := *stored
+	return &user, nil
+}
+
+func (s *MemoryStore) GetByEmail(ctx context.Context, email string) (*User, error) {
+	s.mu.RLock()
+	id, exists := s.byEmail[NormalizeEmail(email)]
+	s.mu.RUnlock()
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+	return s.GetByID(ctx, id)
+}
@@ -0,0 +1,34 @@
+package user
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrInvalidPassword = errors.New("invalid password")
+
+// dummyHash is compared against when a login names an unknown email so the
+// response time does not reveal whether the account exists.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func CheckPassword(hash, password string) error {
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return ErrInvalidPassword
+	}
+	return nil
+}
+
+// CheckDummyPassword burns the same CPU as CheckPassword and always fails.
+func CheckDummyPassword(password string) error {
+	bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+	return ErrInvalidPassword
+}
@@ -0,0 +1,62 @@
+package user
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	if cost, err := bcrypt.Cost([]byte(hash)); err != nil || cost != bcrypt.DefaultCost {
+		t.Errorf("bcrypt cost = %d, %v, want %d", cost, err, bcrypt.DefaultCost)
+	}
+	if again, _ := HashPassword("correct horse"); again == hash {
+		t.Errorf("two hashes of one password are equal, want different salts")
+	}
+
+	tests := []struct {
+		password string
+		wantErr  error
+	}{
+		{"correct horse", nil},
+		{"correct horse ", ErrInvalidPassword},
+		{"Correct horse", ErrInvalidPassword},
+		{"", ErrInvalidPassword},
+	}
+	for _, tt := range tests {
+		if err := CheckPassword(hash, tt.password); !errors.Is(err, tt.wantErr) {
+			t.Errorf("CheckPassword(%q) error = %v, want %v", tt.password, err, tt.wantErr)
+		}
+	}
+	if err := CheckPassword("not a hash", "correct horse"); !errors.Is(err, ErrInvalidPassword) {
+		t.Errorf("CheckPassword against a malformed hash error = %v, want ErrInvalidPassword", err)
+	}
+}
+
+func TestHashPasswordTooLong(t *testing.T) {
+	// bcrypt only reads 72 bytes; longer passwords are refused rather than
+	// silently truncated.
+	long := make([]byte, 73)
+	for i := range long {
+		long[i] = 'a'
+	}
+	if _, err := HashPassword(string(long)); err == nil {
+		t.Errorf("HashPassword of 73 bytes succeeded")
+	}
+}
+
+func TestCheckDummyPassword(t *testing.T) {
+	for _, password := range []string{"dummy-password", "anything"} {
+		if err := CheckDummyPassword(password); !errors.Is(err, ErrInvalidPassword) {
+			t.Errorf("CheckDummyPassword(%q) error = %v, want ErrInvalidPassword", password, err)
+		}
+	}
+	if cost, _ := bcrypt.Cost(dummyHash); cost != bcrypt.DefaultCost {
+		t.Errorf("dummy hash cost = %d, want %d like real hashes", cost, bcrypt.DefaultCost)
+	}
+}
@@ -0,0 +1,76 @@
+package user
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	userKeyPrefix  = "user:"
+	emailKeyPrefix = "user:email:"
+)
+
+type RedisStore struct {
+	redis *redis.Client
+}
+
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{
+		redis: client,
+	}
+}
+
+func (s *RedisStore) Create(ctx context.Context, user *User) error {
+	stored := *user
+	stored.Email = NormalizeEmail(user.Email)
+
+	data, err := json.Marshal(&stored)
+	if err != nil {
+		return err
+	}
+
+	// Claim the email first so two concurrent registrations cannot both win.
+	claimed, err := s.redis.SetNX(ctx, emailKeyPrefix+stored.Email, stored.ID, 0).Result()
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return ErrEmailTaken
+	}
+
+	if err := s.redis.Set(ctx, userKeyPrefix+stored.ID, data, 0).Err(); err != nil {
+		s.redis.Del(ctx, emailKeyPrefix+stored.Email)
+		return err
+	}
+	return nil
+}
+
+func (s *RedisStore) GetByID(ctx context.Context, id string) (*User, error) {
+	data, err := s.redis.Get(ctx, userKeyPrefix+id).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	var user User
+	if err := json.Unmarshal(data, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (s *RedisStore) GetByEmail(ctx context.Context, email string) (*User, error) {
+	id, err := s.redis.Get(ctx, emailKeyPrefix+NormalizeEmail(email)).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return s.GetByID(ctx, id)
+}
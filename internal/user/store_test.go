@@ -0,0 +1,155 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// testStores builds each Store implementation on its own backend.
+var testStores = map[string]func(*testing.T) Store{
+	"memory": func(t *testing.T) Store {
+		return NewMemoryStore()
+	},
+	"redis": func(t *testing.T) Store {
+		server := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		t.Cleanup(func() { client.Close() })
+		return NewRedisStore(client)
+	},
+}
+
+func newTestUser(id, email string) *User {
+	return &User{
+		ID:           id,
+		Email:        email,
+		Name:         "Ada",
+		Role:         RoleUser,
+		PasswordHash: "$2a$10$hash",
+		CreatedAt:    time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	for name, setup := range testStores {
+		t.Run(name, func(t *testing.T) {
+			store := setup(t)
+			if err := store.Create(ctx, newTestUser("u1", "  Ada@Example.com ")); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+
+			want := newTestUser("u1", "ada@example.com")
+			byID, err := store.GetByID(ctx, "u1")
+			if err != nil {
+				t.Fatalf("GetByID: %v", err)
+			}
+			if *byID != *want {
+				t.Errorf("GetByID = %+v, want %+v", byID, want)
+			}
+			byEmail, err := store.GetByEmail(ctx, "ADA@example.com")
+			if err != nil {
+				t.Fatalf("GetByEmail: %v", err)
+			}
+			if *byEmail != *want {
+				t.Errorf("GetByEmail = %+v, want %+v", byEmail, want)
+			}
+
+			// Callers get copies; changing one does not change the account.
+			byID.Role = RoleAdmin
+			if again, _ := store.GetByID(ctx, "u1"); again.Role != RoleUser {
+				t.Errorf("role changed through a returned user")
+			}
+		})
+	}
+}
+
+func TestStoreNotFound(t *testing.T) {
+	ctx := context.Background()
+	for name, setup := range testStores {
+		t.Run(name, func(t *testing.T) {
+			store := setup(t)
+			if _, err := store.GetByID(ctx, "nobody"); !errors.Is(err, ErrUserNotFound) {
+				t.Errorf("GetByID error = %v, want ErrUserNotFound", err)
+			}
+			if _, err := store.GetByEmail(ctx, "nobody@example.com"); !errors.Is(err, ErrUserNotFound) {
+				t.Errorf("GetByEmail error = %v, want ErrUserNotFound", err)
+			}
+		})
+	}
+}
+
+func TestStoreDuplicateEmail(t *testing.T) {
+	ctx := context.Background()
+	for name, setup := range testStores {
+		t.Run(name, func(t *testing.T) {
+			store := setup(t)
+			if err := store.Create(ctx, newTestUser("u1", "ada@example.com")); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			if err := store.Create(ctx, newTestUser("u2", "ADA@example.com")); !errors.Is(err, ErrEmailTaken) {
+				t.Errorf("Create with a taken email error = %v, want ErrEmailTaken", err)
+			}
+			if _, err := store.GetByID(ctx, "u2"); !errors.Is(err, ErrUserNotFound) {
+				t.Errorf("rejected account stored, GetByID error = %v", err)
+			}
+			if account, _ := store.GetByEmail(ctx, "ada@example.com"); account.ID != "u1" {
+				t.Errorf("email now belongs to %s, want u1", account.ID)
+			}
+		})
+	}
+}
+
+func TestStoreConcurrentRegistrations(t *testing.T) {
+	ctx := context.Background()
+	for name, setup := range testStores {
+		t.Run(name, func(t *testing.T) {
+			store := setup(t)
+			var created atomic.Int32
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					err := store.Create(ctx, newTestUser(string(rune('a'+i)), "ada@example.com"))
+					switch {
+					case err == nil:
+						created.Add(1)
+					case !errors.Is(err, ErrEmailTaken):
+						t.Errorf("Create: %v", err)
+					}
+				}(i)
+			}
+			wg.Wait()
+			if got := created.Load(); got != 1 {
+				t.Errorf("%d of 20 registrations of one email succeeded, want 1", got)
+			}
+		})
+	}
+}
+
+func TestRedisStoreUnavailable(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	store := NewRedisStore(client)
+	if err := store.Create(ctx, newTestUser("u1", "ada@example.com")); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	server.SetError("ERR unavailable")
+	if err := store.Create(ctx, newTestUser("u2", "bob@example.com")); err == nil || errors.Is(err, ErrEmailTaken) {
+		t.Errorf("Create error = %v, want the Redis error", err)
+	}
+	// A failing Redis is not a missing account.
+	if _, err := store.GetByEmail(ctx, "ada@example.com"); err == nil || errors.Is(err, ErrUserNotFound) {
+		t.Errorf("GetByEmail error = %v, want the Redis error", err)
+	}
+}